@@ -2,18 +2,23 @@ package main
 
 import (
 	"log"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/sukalov/karaokebot/internal/bot"
 	"github.com/sukalov/karaokebot/internal/bot/admin"
 	"github.com/sukalov/karaokebot/internal/bot/client"
+	"github.com/sukalov/karaokebot/internal/db"
 	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/notify"
+	"github.com/sukalov/karaokebot/internal/payments"
+	"github.com/sukalov/karaokebot/internal/redis"
 	"github.com/sukalov/karaokebot/internal/state"
 	"github.com/sukalov/karaokebot/internal/utils"
 )
 
-// 	// admins        = []string{"sukalov", "olakotr", "yatskovanatoly", "motygapishet"}
-
 type Tokens struct {
 	clientBotToken string
 	adminBotToken  string
@@ -24,28 +29,65 @@ func main() {
 	var wg sync.WaitGroup
 	wg.Add(1)
 
-	userManager := state.NewStateManager()
-	userManager.Init()
-	adminUsernames := []string{"sukalov", "olakotr", "motygapishet"}
+	if err := db.Init(mustDatabaseConfig()); err != nil {
+		log.Fatalf("database initialization failed: %v", err)
+	}
+	defer db.Close()
+
+	userManager := state.NewStateManager(mustStore())
+	if err := userManager.Init(); err != nil {
+		log.Fatalf("failed to load state: %v", err)
+	}
+	access, err := admin.NewAccess(db.Admins)
+	if err != nil {
+		log.Fatalf("failed to load admins: %v", err)
+	}
+	if err := access.EnsureOwners(mustOwnerIDs()); err != nil {
+		log.Fatalf("failed to save owners: %v", err)
+	}
+	if access.Empty() {
+		log.Printf("there are no admins yet, set ADMIN_OWNER_IDS to the telegram IDs of the owners")
+	}
 	tokens := mustTokens()
 
-	adminBot, err := bot.New("AdminBot", tokens.adminBotToken)
+	// TELEGRAM_API_ENDPOINT points both bots at another Bot API server, e.g. a stub for trying out payments
+	apiEndpoint := utils.GetEnv("TELEGRAM_API_ENDPOINT", "")
+
+	adminBot, err := bot.NewWithEndpoint("AdminBot", tokens.adminBotToken, apiEndpoint)
 	if err != nil {
 		log.Fatalf("failed to create admin bot: %v", err)
 	}
 
-	clientBot, err := bot.New("ClientBot", tokens.clientBotToken)
+	clientBot, err := bot.NewWithEndpoint("ClientBot", tokens.clientBotToken, apiEndpoint)
 	if err != nil {
 		log.Fatalf("failed to create client bot: %v", err)
 	}
 
 	logger.Init(adminBot)
 
+	// Singers are notified through the client bot whenever the admin moves the line
+	notifier := notify.New(clientBot)
+	notifier.Attach(userManager)
+
+	// Every handler of both bots survives panics, is counted for /metrics and logged
+	metrics := bot.NewMetrics()
+	for _, b := range []*bot.Bot{adminBot, clientBot} {
+		b.Use(bot.Recover(), metrics.Middleware(), bot.Logging())
+	}
+	// Singers get a burst of updates and then one every half a second, so nobody floods the bot
+	clientBot.Use(bot.RateLimit(10, 500*time.Millisecond))
+
 	// Setup and start admin bot handlers
-	admin.SetupHandlers(adminBot, userManager, adminUsernames)
+	admin.SetupHandlers(adminBot, userManager, access, notifier, metrics)
+
+	// Payment screenshots sent to the client bot are checked by admins in the admin bot
+	paymentDesk := admin.NewPaymentDesk(adminBot, mustPaymentsChatID(), userManager.GetPrice)
+
+	// Singers can also pay with telegram invoices when a payment provider is connected in BotFather
+	invoices := payments.New(utils.GetEnv("PAYMENTS_PROVIDER_TOKEN", ""))
 
 	// Setup and start client bot handlers
-	client.SetupHandlers(clientBot, userManager)
+	client.SetupHandlers(clientBot, userManager, paymentDesk, invoices)
 
 	// Wait indefinitely
 	wg.Wait()
@@ -60,3 +102,78 @@ func mustTokens() Tokens {
 
 	return Tokens{adminBotToken: tokens["ADMIN_BOT_TOKEN"], clientBotToken: tokens["BOT_TOKEN"]}
 }
+
+// mustStore picks where the line is kept from STATE_BACKEND: redis (default) or memory,
+// the memory store is written to STATE_FILE when it is set
+func mustStore() state.Store {
+	switch backend := utils.GetEnv("STATE_BACKEND", "redis"); backend {
+	case "redis":
+		env, err := utils.LoadEnv([]string{"REDIS_URL", "REDIS_PASSWORD"})
+		if err != nil {
+			log.Fatalf("failed to load redis env: %v", err)
+		}
+		store, err := redis.New(env["REDIS_URL"], env["REDIS_PASSWORD"])
+		if err != nil {
+			log.Fatalf("failed to create redis store: %v", err)
+		}
+		return store
+	case "memory":
+		store, err := state.NewMemoryStore(utils.GetEnv("STATE_FILE", ""))
+		if err != nil {
+			log.Fatalf("failed to create memory store: %v", err)
+		}
+		return store
+	default:
+		log.Fatalf("unknown STATE_BACKEND %q, expected redis or memory", backend)
+		return nil
+	}
+}
+
+// mustOwnerIDs returns the telegram user IDs from ADMIN_OWNER_IDS (comma separated), they are made owners
+// when there are no admins yet, owners add the other admins from the admin bot
+func mustOwnerIDs() []int64 {
+	var ownerIDs []int64
+	for _, field := range strings.Split(utils.GetEnv("ADMIN_OWNER_IDS", ""), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		ownerID, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			log.Fatalf("failed to parse ADMIN_OWNER_IDS: %v", err)
+		}
+		ownerIDs = append(ownerIDs, ownerID)
+	}
+	return ownerIDs
+}
+
+// mustPaymentsChatID returns PAYMENTS_CHAT_ID, payment screenshots go to the log channel when it is not set
+func mustPaymentsChatID() int64 {
+	value := utils.GetEnv("PAYMENTS_CHAT_ID", "")
+	if value == "" {
+		return logger.ChannelID
+	}
+	chatID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("failed to parse PAYMENTS_CHAT_ID: %v", err)
+	}
+	return chatID
+}
+
+// mustDatabaseConfig picks the database from DB_DRIVER: turso (default) or sqlite,
+// the sqlite file is SQLITE_PATH
+func mustDatabaseConfig() db.Config {
+	switch driver := utils.GetEnv("DB_DRIVER", db.DriverTurso); driver {
+	case db.DriverTurso:
+		env, err := utils.LoadEnv([]string{"TURSO_DATABASE_URL", "TURSO_AUTH_TOKEN"})
+		if err != nil {
+			log.Fatalf("failed to load db env: %v", err)
+		}
+		return db.Config{Driver: driver, URL: env["TURSO_DATABASE_URL"], AuthToken: env["TURSO_AUTH_TOKEN"]}
+	case db.DriverSQLite:
+		return db.Config{Driver: driver, Path: utils.GetEnv("SQLITE_PATH", "karaoke.db")}
+	default:
+		log.Fatalf("unknown DB_DRIVER %q, expected %s or %s", driver, db.DriverTurso, db.DriverSQLite)
+		return db.Config{}
+	}
+}
@@ -0,0 +1,250 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+// Permission is an action in the admin bot that only some roles may take
+type Permission string
+
+const (
+	// PermRunLine covers opening and closing the signup, calling singers, editing the queue and limits
+	PermRunLine Permission = "run_line"
+	// PermClearLine ends the night and archives the line
+	PermClearLine Permission = "clear_line"
+	// PermPayments covers the price, payment methods and checking payment screenshots
+	PermPayments Permission = "payments"
+	// PermSongbook covers editing songs and reviewing song requests
+	PermSongbook Permission = "songbook"
+	// PermSite covers rebuilding the songbook site and editing its promo
+	PermSite Permission = "site"
+	// PermStats covers history and statistics
+	PermStats Permission = "stats"
+	// PermAdmins covers adding and removing admins
+	PermAdmins Permission = "admins"
+)
+
+var rolePermissions = map[string][]Permission{
+	db.RoleOwner:  {PermRunLine, PermClearLine, PermPayments, PermSongbook, PermSite, PermStats, PermAdmins},
+	db.RoleHost:   {PermRunLine, PermClearLine, PermPayments, PermStats},
+	db.RoleEditor: {PermSongbook, PermSite, PermStats},
+}
+
+// roleNames are the roles as admins see them
+var roleNames = map[string]string{
+	db.RoleOwner:  "владелец",
+	db.RoleHost:   "ведущий",
+	db.RoleEditor: "редактор сонгбука",
+}
+
+// ErrLastOwner means removing or demoting the admin would leave nobody to manage admins
+var ErrLastOwner = errors.New("cannot remove the last owner")
+
+// Access keeps the admins in memory and decides who may do what, changes go through to the database
+type Access struct {
+	repo   *db.AdminsType
+	admins map[int64]db.Admin
+	mu     sync.RWMutex
+}
+
+// NewAccess loads the admins from the database
+func NewAccess(repo *db.AdminsType) (*Access, error) {
+	access := &Access{repo: repo}
+	if err := access.reload(); err != nil {
+		return nil, err
+	}
+	return access, nil
+}
+
+func (a *Access) reload() error {
+	list, err := a.repo.List()
+	if err != nil {
+		return err
+	}
+	admins := make(map[int64]db.Admin, len(list))
+	for _, admin := range list {
+		admins[admin.UserID] = admin
+	}
+
+	a.mu.Lock()
+	a.admins = admins
+	a.mu.Unlock()
+	return nil
+}
+
+// Can reports whether the user may take the action
+func (a *Access) Can(user *tgbotapi.User, permission Permission) bool {
+	if user == nil {
+		return false
+	}
+	a.mu.RLock()
+	admin, ok := a.admins[user.ID]
+	a.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	// usernames change, keep the stored one fresh so the admin list stays readable
+	if admin.Username.String != user.UserName {
+		if err := a.repo.UpdateUsername(user.ID, user.UserName); err != nil {
+			logger.Error(true, fmt.Sprintf("Failed to update admin username\nUser ID: %d\nError: %v", user.ID, err))
+		} else {
+			a.mu.Lock()
+			admin.Username.String, admin.Username.Valid = user.UserName, user.UserName != ""
+			a.admins[user.ID] = admin
+			a.mu.Unlock()
+		}
+	}
+
+	for _, allowed := range rolePermissions[admin.Role] {
+		if allowed == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Denied explains to the user why the action is not allowed
+func (a *Access) Denied(user *tgbotapi.User) string {
+	if _, ok := a.Get(user.ID); ok {
+		return "у вас нет прав на это"
+	}
+	return "вы не админ"
+}
+
+// Get returns the admin with the given telegram user ID
+func (a *Access) Get(userID int64) (db.Admin, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	admin, ok := a.admins[userID]
+	return admin, ok
+}
+
+// List returns every admin, oldest first
+func (a *Access) List() ([]db.Admin, error) {
+	return a.repo.List()
+}
+
+// countOwners must be called with the lock held
+func (a *Access) countOwners() int {
+	owners := 0
+	for _, admin := range a.admins {
+		if admin.Role == db.RoleOwner {
+			owners++
+		}
+	}
+	return owners
+}
+
+// Save adds an admin or changes their role
+func (a *Access) Save(admin db.Admin) error {
+	a.mu.RLock()
+	current, exists := a.admins[admin.UserID]
+	lastOwner := exists && current.Role == db.RoleOwner && admin.Role != db.RoleOwner && a.countOwners() == 1
+	a.mu.RUnlock()
+	if lastOwner {
+		return ErrLastOwner
+	}
+
+	if err := a.repo.Save(admin); err != nil {
+		return err
+	}
+	return a.reload()
+}
+
+// Remove takes the admin rights away
+func (a *Access) Remove(userID int64) error {
+	a.mu.RLock()
+	current, exists := a.admins[userID]
+	lastOwner := exists && current.Role == db.RoleOwner && a.countOwners() == 1
+	a.mu.RUnlock()
+	if lastOwner {
+		return ErrLastOwner
+	}
+
+	if err := a.repo.Remove(userID); err != nil {
+		return err
+	}
+	return a.reload()
+}
+
+// EnsureOwners makes the given users owners while there are no admins at all, so a fresh database
+// has someone to add the others. Once admins exist they are managed only in the bot, so owners
+// demoted or removed there stay that way after a restart.
+func (a *Access) EnsureOwners(userIDs []int64) error {
+	if !a.Empty() {
+		return nil
+	}
+	for _, userID := range userIDs {
+		if err := a.Save(db.Admin{UserID: userID, Role: db.RoleOwner}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Empty reports whether nobody can use the admin bot yet
+func (a *Access) Empty() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.admins) == 0
+}
+
+// Require lets only admins with the permission through to the handler, others are told why not
+func (a *Access) Require(permission Permission) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(b *bot.Bot, update tgbotapi.Update) error {
+			user := bot.Sender(update)
+			if !a.Can(user, permission) {
+				if user == nil {
+					return nil
+				}
+				return b.Reply(update, a.Denied(user))
+			}
+			return next(b, update)
+		}
+	}
+}
+
+// RequireAdmin keeps everyone who is not an admin out of the bot, the listed commands stay open to all
+func (a *Access) RequireAdmin(open ...string) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(b *bot.Bot, update tgbotapi.Update) error {
+			user := bot.Sender(update)
+			if user == nil {
+				return nil
+			}
+			if update.Message != nil && update.Message.IsCommand() {
+				for _, command := range open {
+					if update.Message.Command() == command {
+						return next(b, update)
+					}
+				}
+			}
+			if _, ok := a.Get(user.ID); !ok {
+				return b.Reply(update, a.Denied(user))
+			}
+			return next(b, update)
+		}
+	}
+}
+
+// stopDialog tells an admin who lost the permission in the middle of a dialog that they cannot finish it.
+// It returns false and does nothing while the admin still has the permission.
+func (a *Access) stopDialog(b *bot.Bot, update tgbotapi.Update, permission Permission) bool {
+	user := bot.Sender(update)
+	if a.Can(user, permission) {
+		return false
+	}
+	if user != nil {
+		b.Reply(update, a.Denied(user))
+	}
+	return true
+}
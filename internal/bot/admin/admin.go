@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -19,6 +21,8 @@ import (
 	"github.com/sukalov/karaokebot/internal/logger"
 	"github.com/sukalov/karaokebot/internal/lyrics"
 	"github.com/sukalov/karaokebot/internal/state"
+	"github.com/sukalov/karaokebot/internal/users"
+	"github.com/sukalov/karaokebot/internal/utils"
 )
 
 type PromoEditState struct {
@@ -31,74 +35,181 @@ type PromoEditState struct {
 
 type AdminHandlers struct {
 	userManager     *state.StateManager
-	admins          map[string]bool
-	clearInProgress map[string]bool
+	access          *Access
+	clearInProgress map[int64]bool
 	promoEditState  map[int64]*PromoEditState
-	lyricsService   *lyrics.Service
+	walkIns         map[int64]*WalkInState
+	// paymentMethodDrafts holds the payment method an admin is adding, by chat
+	paymentMethodDrafts map[int64]*state.PaymentMethod
+	lyricsService       *lyrics.Service
+	notifier            Notifier
+	// metrics are the counters shown by /metrics, nil when nobody collects them
+	metrics *bot.Metrics
+	mu      sync.Mutex
 }
 
-func NewAdminHandlers(userManager *state.StateManager, adminUsernames []string) *AdminHandlers {
-	admins := make(map[string]bool)
-	clearInProgress := make(map[string]bool)
-	promoEditState := make(map[int64]*PromoEditState)
-	for _, username := range adminUsernames {
-		admins[username] = true
-		clearInProgress[username] = false
-	}
-
+func NewAdminHandlers(userManager *state.StateManager, access *Access, notifier Notifier) *AdminHandlers {
 	return &AdminHandlers{
-		userManager:     userManager,
-		admins:          admins,
-		clearInProgress: clearInProgress,
-		promoEditState:  promoEditState,
-		lyricsService:   lyrics.NewService(),
+		userManager:         userManager,
+		notifier:            notifier,
+		access:              access,
+		clearInProgress:     make(map[int64]bool),
+		promoEditState:      make(map[int64]*PromoEditState),
+		walkIns:             make(map[int64]*WalkInState),
+		paymentMethodDrafts: make(map[int64]*state.PaymentMethod),
+		lyricsService:       lyrics.NewService(),
 	}
 }
 
 func (h *AdminHandlers) clearLineHandler(b *bot.Bot, update tgbotapi.Update) error {
 	message := update.Message
 
-	if !h.admins[message.From.UserName] {
-		return b.SendMessage(message.Chat.ID, "вы не админ")
-	}
-	h.clearInProgress[update.Message.From.UserName] = true
+	h.mu.Lock()
+	h.clearInProgress[message.From.ID] = true
+	h.mu.Unlock()
 	logger.Info(true, fmt.Sprintf("Admin %s initiated clear line", message.From.UserName))
-	return b.SendMessageWithButtons(message.Chat.ID, "весь список будет безвозвратно удалён! уверены?",
+	return b.SendMessageWithButtons(message.Chat.ID, "вечер будет завершён: список уйдёт в архив (/history), запись закроется, а очередь начнётся с чистого листа. уверены?",
 		tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("удаляем", "confirm_clear_line"),
+				tgbotapi.NewInlineKeyboardButtonData("завершаем", "confirm_clear_line"),
 				tgbotapi.NewInlineKeyboardButtonData("отмена", "abort_clear_line"),
 			),
 		),
 	)
 }
 
-func (h *AdminHandlers) limitHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
+func orderingRow(ordering string) []tgbotapi.InlineKeyboardButton {
+	if ordering == state.OrderingRoundRobin {
+		return tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("очередь по времени записи", "set_ordering:"+state.OrderingFIFO),
+		)
 	}
+	return tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("очередь по кругу", "set_ordering:"+state.OrderingRoundRobin),
+	)
+}
 
-	chatID := update.Message.Chat.ID
-	limit := h.userManager.GetLimit()
-	if limit == 3 {
-		return b.SendMessageWithButtons(chatID, "сейчас один человек может спеть максимум 3 песни", tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("убрать лимит", "disable_limit"),
-			),
-		))
+func orderingDescription(ordering string) string {
+	if ordering == state.OrderingRoundRobin {
+		return "очередь идёт по кругу: пока все не спели по первой песне, вторые не начинаются"
+	}
+	return "очередь идёт по времени записи"
+}
+
+// limitDescription tells admins what the limits are, with numbers the way singers will see them
+func limitDescription(limit, waitingLimit int) string {
+	var description string
+	if limit == state.NoLimit {
+		description = "за вечер любой может петь сколько угодно раз"
+	} else {
+		description = fmt.Sprintf("за вечер один человек может спеть максимум %d %s", limit, utils.Plural(limit, "песню", "песни", "песен"))
+	}
+	if waitingLimit != state.NoLimit {
+		description += fmt.Sprintf("\nодновременно в очереди — не больше %d %s от человека", waitingLimit, utils.Plural(waitingLimit, "песни", "песен", "песен"))
+	}
+	return description
+}
+
+// parseLimits reads "/limit <за вечер> [одновременно]", "off" or 0 turns a limit off
+func parseLimits(args string) (limit, waitingLimit int, err error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, 0, fmt.Errorf("expected one or two values, got %d", len(fields))
+	}
+	values := make([]int, 2)
+	for i, field := range fields {
+		if field == "off" {
+			continue
+		}
+		value, err := strconv.Atoi(field)
+		if err != nil || value < 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q", field)
+		}
+		values[i] = value
+	}
+	return values[0], values[1], nil
+}
+
+func (h *AdminHandlers) limitHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	chatID := message.Chat.ID
+	if args := strings.TrimSpace(message.CommandArguments()); args != "" {
+		limit, waitingLimit, err := parseLimits(args)
+		if err != nil {
+			return b.SendMessage(chatID, "использование: /limit <песен за вечер> [песен в очереди одновременно]\n0 или off — без лимита")
+		}
+		return h.applyLimits(b, chatID, message.From.UserName, limit, waitingLimit)
 	}
-	return b.SendMessageWithButtons(chatID, "сейчас любой может петь сколько угодно раз", tgbotapi.NewInlineKeyboardMarkup(
+
+	text, keyboard := h.limitsPicker()
+	return b.SendMessageWithButtons(chatID, text, keyboard)
+}
+
+// limitsPicker is the /limit message with the current limits and ordering and buttons to change them
+func (h *AdminHandlers) limitsPicker() (string, tgbotapi.InlineKeyboardMarkup) {
+	ordering := h.userManager.GetOrdering()
+	text := fmt.Sprintf("%s\n%s\n\nпоменять: /limit <песен за вечер> [песен в очереди одновременно], 0 — без лимита",
+		limitDescription(h.userManager.GetLimit(), h.userManager.GetWaitingLimit()), orderingDescription(ordering))
+	return text, tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("включить лимит в три песни", "enable_limit"),
+			tgbotapi.NewInlineKeyboardButtonData("3 песни за вечер", fmt.Sprintf("set_limit:%d:%d", 3, state.NoLimit)),
+			tgbotapi.NewInlineKeyboardButtonData("убрать лимиты", fmt.Sprintf("set_limit:%d:%d", state.NoLimit, state.NoLimit)),
 		),
-	))
+		orderingRow(ordering),
+	)
 }
 
-func (h *AdminHandlers) testLyricsHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
+func (h *AdminHandlers) setLimitHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
 	}
 
+	limit, waitingLimit, err := parseLimits(strings.ReplaceAll(strings.TrimPrefix(query.Data, "set_limit:"), ":", " "))
+	if err != nil {
+		return b.SendMessage(query.From.ID, "ошибка: неверный формат данных")
+	}
+	return h.applyLimits(b, query.From.ID, query.From.UserName, limit, waitingLimit)
+}
+
+func (h *AdminHandlers) applyLimits(b *bot.Bot, chatID int64, admin string, limit, waitingLimit int) error {
+	ctx := context.Background()
+	if err := h.userManager.SetLimit(ctx, limit); err != nil {
+		return b.SendMessage(chatID, "случилась ошибка")
+	}
+	if err := h.userManager.SetWaitingLimit(ctx, waitingLimit); err != nil {
+		return b.SendMessage(chatID, "случилась ошибка")
+	}
+	logger.Info(true, fmt.Sprintf("Admin %s set limits: %d per night, %d waiting (0 means no limit)", admin, limit, waitingLimit))
+	return b.SendMessage(chatID, "готово. "+limitDescription(limit, waitingLimit))
+}
+
+func (h *AdminHandlers) setOrderingHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+	}
+
+	chatID := query.Message.Chat.ID
+	ordering := strings.TrimPrefix(query.Data, "set_ordering:")
+	ctx := context.Background()
+	if err := h.userManager.SetOrdering(ctx, ordering); err != nil {
+		return b.SendMessage(chatID, "случилась ошибка")
+	}
+	logger.Info(true, fmt.Sprintf("Admin %s set queue ordering to %s", query.From.UserName, ordering))
+
+	// the picker shows the new ordering and the button to switch back
+	text, keyboard := h.limitsPicker()
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, text, keyboard)
+	if _, err := b.Client.Send(editMsg); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return err
+	}
+	return nil
+}
+
+func (h *AdminHandlers) testLyricsHandler(b *bot.Bot, update tgbotapi.Update) error {
 	message := update.Message
 	text := message.Text
 
@@ -135,27 +246,74 @@ func (h *AdminHandlers) testLyricsHandler(b *bot.Bot, update tgbotapi.Update) er
 
 func (h *AdminHandlers) confirmHandler(b *bot.Bot, update tgbotapi.Update) error {
 	ctx := context.Background()
-	if h.clearInProgress[update.CallbackQuery.From.UserName] {
-		h.userManager.Clear(ctx)
-		h.clearInProgress[update.CallbackQuery.From.UserName] = false
-		logger.Info(true, fmt.Sprintf("Admin %s cleared the line", update.CallbackQuery.From.UserName))
-		return b.SendMessage(update.CallbackQuery.From.ID, "список очищен")
+	if h.takeClearInProgress(update.CallbackQuery.From.ID) {
+		archived := false
+		err := h.userManager.EndSession(ctx, func(session users.Session, price int, entries []users.UserState) error {
+			if err := db.Sessions.Archive(session, price, entries); err != nil {
+				return err
+			}
+			archived = true
+			return nil
+		})
+		if err != nil {
+			logger.Error(true, fmt.Sprintf("Failed to end session\nAdmin: %s\nError: %v", update.CallbackQuery.From.UserName, err))
+			if !archived {
+				return b.SendMessage(update.CallbackQuery.From.ID, "не получилось сохранить вечер в архив, список не тронут")
+			}
+			return b.SendMessage(update.CallbackQuery.From.ID, "вечер сохранён в архив, но список очистить не вышло. попробуйте /clear_line ещё раз")
+		}
+		logger.Info(true, fmt.Sprintf("Admin %s archived the night and cleared the line", update.CallbackQuery.From.UserName))
+		return b.SendMessage(update.CallbackQuery.From.ID, "вечер сохранён в архив, список очищен")
 	}
 	return b.SendMessage(update.CallbackQuery.From.ID, "кнопка уже не работает")
 }
 
+func (h *AdminHandlers) historyHandler(b *bot.Bot, update tgbotapi.Update) error {
+	sessions, err := db.Sessions.Recent(10)
+	if err != nil {
+		logger.Error(true, fmt.Sprintf("Failed to load sessions history\nError: %v", err))
+		return b.SendMessage(update.Message.Chat.ID, "не получилось загрузить историю")
+	}
+	if len(sessions) == 0 {
+		return b.SendMessage(update.Message.Chat.ID, "в архиве пока нет ни одного вечера")
+	}
+
+	moscowLocation := time.FixedZone("Moscow Time", 3*60*60)
+	var builder strings.Builder
+	builder.WriteString("последние вечера:\n\n")
+	for _, session := range sessions {
+		price := "бесплатно"
+		if session.Price > 0 {
+			price = fmt.Sprintf("%d ₽", session.Price)
+		}
+		builder.WriteString(fmt.Sprintf("%s–%s · записей: %d · спели: %d · %s\n",
+			session.OpenedAt.In(moscowLocation).Format("02.01.2006 15:04"),
+			session.ClosedAt.In(moscowLocation).Format("15:04"),
+			session.Entries,
+			session.Performed,
+			price,
+		))
+	}
+	return b.SendMessage(update.Message.Chat.ID, builder.String())
+}
+
+// takeClearInProgress reports whether the admin asked to end the night, the question can be answered only once
+func (h *AdminHandlers) takeClearInProgress(userID int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	asked := h.clearInProgress[userID]
+	delete(h.clearInProgress, userID)
+	return asked
+}
+
 func (h *AdminHandlers) abortHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if h.clearInProgress[update.CallbackQuery.From.UserName] {
-		h.clearInProgress[update.CallbackQuery.From.UserName] = false
+	if h.takeClearInProgress(update.CallbackQuery.From.ID) {
 		return b.SendMessage(update.CallbackQuery.From.ID, "ок. отменили")
 	}
 	return b.SendMessage(update.CallbackQuery.From.ID, "кнопка уже не работает")
 }
 
 func (h *AdminHandlers) openLineHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
 	ctx := context.Background()
 	if err := h.userManager.OpenList(ctx); err != nil {
 		return b.SendMessage(update.Message.From.ID, "случилась ошибка")
@@ -165,9 +323,6 @@ func (h *AdminHandlers) openLineHandler(b *bot.Bot, update tgbotapi.Update) erro
 }
 
 func (h *AdminHandlers) closeLineHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
 	ctx := context.Background()
 	if err := h.userManager.CloseList(ctx); err != nil {
 		return b.SendMessage(update.Message.From.ID, "случилась ошибка")
@@ -176,31 +331,7 @@ func (h *AdminHandlers) closeLineHandler(b *bot.Bot, update tgbotapi.Update) err
 	return b.SendMessage(update.Message.From.ID, "запись закрыта")
 }
 
-func (h *AdminHandlers) enableLimitHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.CallbackQuery.From.UserName] {
-		return b.SendMessage(update.CallbackQuery.From.ID, "вы не админ")
-	}
-	ctx := context.Background()
-	h.userManager.SetLimit(ctx, 3)
-	logger.Info(true, fmt.Sprintf("Admin %s enabled limit (3 songs)", update.CallbackQuery.From.UserName))
-	return b.SendMessage(update.CallbackQuery.From.ID, "лимит ON. теперь каждый поёт не больше трёх раз")
-}
-
-func (h *AdminHandlers) disableLimitHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.CallbackQuery.From.UserName] {
-		return b.SendMessage(update.CallbackQuery.From.ID, "вы не админ")
-	}
-	ctx := context.Background()
-	h.userManager.SetLimit(ctx, 1000)
-	logger.Info(true, fmt.Sprintf("Admin %s disabled limit", update.CallbackQuery.From.UserName))
-	return b.SendMessage(update.CallbackQuery.From.ID, "лимит OFF. все поют сколько угодно")
-}
-
 func (h *AdminHandlers) changePriceHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
-
 	message := update.Message
 	text := message.Text
 
@@ -233,6 +364,34 @@ func (h *AdminHandlers) changePriceHandler(b *bot.Bot, update tgbotapi.Update) e
 	return b.SendMessage(message.Chat.ID, fmt.Sprintf("установлена цена %d рублей за песню", price))
 }
 
+func (h *AdminHandlers) songDurationHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	text := message.Text
+
+	args := strings.TrimPrefix(text, "/song_duration ")
+	if args == text {
+		return b.SendMessage(message.Chat.ID, fmt.Sprintf("сейчас на одну песню закладываем %d мин\n\nиспользование: /song_duration <минуты>", h.userManager.GetSongDuration()))
+	}
+
+	var minutes int
+	_, err := fmt.Sscanf(strings.TrimSpace(args), "%d", &minutes)
+	if err != nil {
+		return b.SendMessage(message.Chat.ID, "неверный формат числа")
+	}
+
+	if minutes <= 0 {
+		return b.SendMessage(message.Chat.ID, "длительность должна быть больше нуля")
+	}
+
+	ctx := context.Background()
+	if err := h.userManager.SetSongDuration(ctx, minutes); err != nil {
+		return b.SendMessage(message.Chat.ID, "случилась ошибка при сохранении длительности")
+	}
+
+	logger.Info(true, fmt.Sprintf("Admin %s set average song duration to %d minutes", message.From.UserName, minutes))
+	return b.SendMessage(message.Chat.ID, fmt.Sprintf("теперь на одну песню закладываем %d мин. когда споют хотя бы три песни, время будет считаться по реальному темпу", minutes))
+}
+
 func (h *AdminHandlers) ShowPromoHandler(b *bot.Bot, update tgbotapi.Update) error {
 	return h.updatePromoAndRebuild(b, update, "true")
 }
@@ -242,10 +401,6 @@ func (h *AdminHandlers) HidePromoHandler(b *bot.Bot, update tgbotapi.Update) err
 }
 
 func (h *AdminHandlers) EditPromoHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
-
 	chatID := update.Message.Chat.ID
 
 	// Fetch current promo values
@@ -270,10 +425,6 @@ func (h *AdminHandlers) RebuildHandler(b *bot.Bot, update tgbotapi.Update) error
 }
 
 func (h *AdminHandlers) updatePromoAndRebuild(b *bot.Bot, update tgbotapi.Update, value string) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
-
 	githubToken := os.Getenv("GITHUB_PAT_TOKEN")
 	repo := "sukalov/karaoke" // update this if needed
 
@@ -349,10 +500,6 @@ func (h *AdminHandlers) updatePromoAndRebuild(b *bot.Bot, update tgbotapi.Update
 }
 
 func (h *AdminHandlers) triggerGithubAction(b *bot.Bot, update tgbotapi.Update, eventType string, promoValue string) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
-
 	githubWebhookURL := os.Getenv("GITHUB_REDEPLOY_HOOK")
 	githubToken := os.Getenv("GITHUB_PAT_TOKEN")
 
@@ -554,10 +701,6 @@ func (h *AdminHandlers) sendPromoEditMessage(b *bot.Bot, chatID int64, messageID
 }
 
 func (h *AdminHandlers) editPromoCallbackHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.CallbackQuery.From.UserName] {
-		return b.SendMessage(update.CallbackQuery.Message.Chat.ID, "вы не админ")
-	}
-
 	chatID := update.CallbackQuery.Message.Chat.ID
 	data := update.CallbackQuery.Data
 
@@ -596,6 +739,10 @@ func (h *AdminHandlers) handlePromoMessageInput(b *bot.Bot, update tgbotapi.Upda
 	if !exists {
 		return nil // Let search handler process normal messages
 	}
+	if h.access.stopDialog(b, update, PermSite) {
+		delete(h.promoEditState, chatID)
+		return bot.ErrMessageHandled
+	}
 
 	if state.editingText {
 		if strings.TrimSpace(text) == "" {
@@ -737,11 +884,12 @@ func (h *AdminHandlers) updateGitHubVariable(repo, token, name, value string) er
 	return nil
 }
 
-func SetupHandlers(adminBot *bot.Bot, userManager *state.StateManager, adminUsernames []string) {
+func SetupHandlers(adminBot *bot.Bot, userManager *state.StateManager, access *Access, notifier Notifier, metrics *bot.Metrics) {
 	// Create handlers
-	handlers := NewAdminHandlers(userManager, adminUsernames)
+	handlers := NewAdminHandlers(userManager, access, notifier)
+	handlers.metrics = metrics
 	songManager := db.Songbook
-	searchHandlers := NewSearchHandler(adminUsernames, songManager)
+	searchHandlers := NewSearchHandler(songManager, notifier)
 
 	// Get common handlers
 	commandHandlers := common.GetCommandHandlers(userManager)
@@ -761,11 +909,28 @@ func SetupHandlers(adminBot *bot.Bot, userManager *state.StateManager, adminUser
 	commandHandlers["newsong"] = searchHandlers.newSongHandler
 	commandHandlers["newsongform"] = searchHandlers.newSongFormHandler
 	commandHandlers["limit"] = handlers.limitHandler
+	commandHandlers["hold_unpaid"] = handlers.holdUnpaidHandler
+	commandHandlers["payment_methods"] = handlers.paymentMethodsHandler
 	commandHandlers["change_price"] = handlers.changePriceHandler
 	commandHandlers["test_lyrics"] = handlers.testLyricsHandler
-
-	// Add message handler
-	messageHandlers = append(messageHandlers, handlers.handlePromoMessageInput, searchHandlers.messageHandler)
+	commandHandlers["now"] = handlers.nowHandler
+	commandHandlers["next"] = handlers.nextHandler
+	commandHandlers["song_duration"] = handlers.songDurationHandler
+	commandHandlers["queue"] = handlers.queueEditorHandler
+	commandHandlers["walkin"] = handlers.walkInHandler
+	commandHandlers["history"] = handlers.historyHandler
+	commandHandlers["stats"] = handlers.statsHandler
+	commandHandlers["metrics"] = handlers.metricsHandler
+	commandHandlers["requests"] = searchHandlers.requestsHandler
+	commandHandlers["whoami"] = handlers.whoamiHandler
+	commandHandlers["admins"] = handlers.adminsHandler
+	commandHandlers["add_admin"] = handlers.addAdminHandler
+	commandHandlers["remove_admin"] = handlers.removeAdminHandler
+
+	// Add message handler, the dialogs check the permission themselves so an admin who loses it
+	// halfway cannot finish; whatever is left goes to the songbook search
+	messageHandlers = append(messageHandlers, handlers.handlePromoMessageInput, handlers.handleWalkInInput, handlers.handlePaymentMethodInput,
+		bot.Chain(searchHandlers.messageHandler, access.Require(PermSongbook)))
 
 	// Add callback handlers for all possible prefixes
 	callbackHandlers["edit_song"] = searchHandlers.callbackHandler
@@ -774,13 +939,72 @@ func SetupHandlers(adminBot *bot.Bot, userManager *state.StateManager, adminUser
 	callbackHandlers["select_category"] = searchHandlers.selectCategoryCallbackHandler
 	callbackHandlers["abort_clear_line"] = handlers.abortHandler
 	callbackHandlers["confirm_clear_line"] = handlers.confirmHandler
-	callbackHandlers["enable_limit"] = handlers.enableLimitHandler
-	callbackHandlers["disable_limit"] = handlers.disableLimitHandler
+	callbackHandlers["set_limit"] = handlers.setLimitHandler
+	callbackHandlers["pay_ok"] = handlers.paymentCallbackHandler
+	callbackHandlers["pay_reject"] = handlers.paymentCallbackHandler
+	callbackHandlers["paymethod_add"] = handlers.paymentMethodCallbackHandler
+	callbackHandlers["paymethod_del"] = handlers.paymentMethodCallbackHandler
+	callbackHandlers["paymethod_cancel"] = handlers.paymentMethodCallbackHandler
+	callbackHandlers["set_ordering"] = handlers.setOrderingHandler
+	callbackHandlers["req_approve"] = searchHandlers.requestCallbackHandler
+	callbackHandlers["req_reject"] = searchHandlers.requestCallbackHandler
 	callbackHandlers["edit_promo_text"] = handlers.editPromoCallbackHandler
 	callbackHandlers["edit_promo_url"] = handlers.editPromoCallbackHandler
 	callbackHandlers["confirm_promo_edit"] = handlers.editPromoCallbackHandler
 	callbackHandlers["cancel_promo_edit"] = handlers.editPromoCallbackHandler
+	callbackHandlers["queue_next"] = handlers.queueCallbackHandler
+	callbackHandlers["queue_done"] = handlers.queueCallbackHandler
+	callbackHandlers["queue_skip"] = handlers.queueCallbackHandler
+	callbackHandlers["queue_noshow"] = handlers.queueCallbackHandler
+	callbackHandlers["qedit_up"] = handlers.queueEditCallbackHandler
+	callbackHandlers["qedit_down"] = handlers.queueEditCallbackHandler
+	callbackHandlers["qedit_top"] = handlers.queueEditCallbackHandler
+	callbackHandlers["qedit_remove"] = handlers.queueEditCallbackHandler
+	callbackHandlers["qedit_remove_yes"] = handlers.queueEditCallbackHandler
+	callbackHandlers["qedit_refresh"] = handlers.queueEditCallbackHandler
+	callbackHandlers["qedit_walkin"] = handlers.queueEditCallbackHandler
+	callbackHandlers["qedit_walkin_cancel"] = handlers.queueEditCallbackHandler
+
+	// Only admins whose role allows it get through to the handlers
+	routes := []bot.Route{
+		{
+			Commands:   []string{"line", "users", "open", "close", "now", "next", "limit", "song_duration", "queue", "walkin"},
+			Callbacks:  []string{"set_limit", "set_ordering", "queue_next", "queue_done", "queue_skip", "queue_noshow", "qedit_up", "qedit_down", "qedit_top", "qedit_remove", "qedit_remove_yes", "qedit_refresh", "qedit_walkin", "qedit_walkin_cancel"},
+			Middleware: []bot.Middleware{access.Require(PermRunLine)},
+		},
+		{
+			Commands:   []string{"clear_line"},
+			Callbacks:  []string{"confirm_clear_line", "abort_clear_line"},
+			Middleware: []bot.Middleware{access.Require(PermClearLine)},
+		},
+		{
+			Commands:   []string{"change_price", "hold_unpaid", "payment_methods"},
+			Callbacks:  []string{"pay_ok", "pay_reject", "paymethod_add", "paymethod_del", "paymethod_cancel"},
+			Middleware: []bot.Middleware{access.Require(PermPayments)},
+		},
+		{
+			Commands:   []string{"findsong", "cancel", "newsong", "newsongform", "test_lyrics", "requests"},
+			Callbacks:  []string{"edit_song", "edit_field", "delete_song", "select_category", "req_approve", "req_reject"},
+			Middleware: []bot.Middleware{access.Require(PermSongbook)},
+		},
+		{
+			Commands:   []string{"rebuild", "show_promo", "hide_promo", "edit_promo"},
+			Callbacks:  []string{"edit_promo_text", "edit_promo_url", "confirm_promo_edit", "cancel_promo_edit"},
+			Middleware: []bot.Middleware{access.Require(PermSite)},
+		},
+		{
+			Commands:   []string{"history", "stats", "metrics"},
+			Middleware: []bot.Middleware{access.Require(PermStats)},
+		},
+		{
+			Commands:   []string{"admins", "add_admin", "remove_admin"},
+			Middleware: []bot.Middleware{access.Require(PermAdmins)},
+		},
+	}
+
+	// Nobody but admins gets anywhere, /whoami is open so people can tell the owners their ID
+	adminBot.Use(access.RequireAdmin("whoami"))
 
 	// Start the bot
-	go adminBot.Start(commandHandlers, messageHandlers, callbackHandlers)
+	go adminBot.Start(commandHandlers, messageHandlers, callbackHandlers, routes...)
 }
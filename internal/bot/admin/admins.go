@@ -0,0 +1,136 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+func adminTitle(admin db.Admin) string {
+	if admin.Username.Valid && admin.Username.String != "" {
+		return fmt.Sprintf("@%s (%d)", admin.Username.String, admin.UserID)
+	}
+	return strconv.FormatInt(admin.UserID, 10)
+}
+
+// resolveUser finds the telegram user ID for "@username" or a numeric ID. Usernames are looked up
+// among admins and singers of the client bot, telegram does not tell bots the ID of a username.
+func (h *AdminHandlers) resolveUser(text string) (int64, string, error) {
+	if userID, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return userID, "", nil
+	}
+
+	username := strings.TrimPrefix(text, "@")
+	admins, err := h.access.List()
+	if err != nil {
+		return 0, "", err
+	}
+	for _, admin := range admins {
+		if strings.EqualFold(admin.Username.String, username) {
+			return admin.UserID, admin.Username.String, nil
+		}
+	}
+
+	user, err := db.Users.GetByUsername(username)
+	if err != nil {
+		return 0, "", err
+	}
+	return user.ChatID, user.Username.String, nil
+}
+
+// whoamiHandler tells anyone their telegram ID, owners need it to add them as admins
+func (h *AdminHandlers) whoamiHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	text := fmt.Sprintf("ваш telegram id: %d", message.From.ID)
+	if admin, ok := h.access.Get(message.From.ID); ok {
+		text += fmt.Sprintf("\nроль: %s", roleNames[admin.Role])
+	}
+	return b.SendMessage(message.Chat.ID, text)
+}
+
+func (h *AdminHandlers) adminsHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	admins, err := h.access.List()
+	if err != nil {
+		logger.Error(true, fmt.Sprintf("Failed to list admins\nError: %v", err))
+		return b.SendMessage(message.Chat.ID, "не получилось загрузить админов")
+	}
+
+	var builder strings.Builder
+	builder.WriteString("админы:\n")
+	for _, admin := range admins {
+		builder.WriteString(fmt.Sprintf("\n• %s — %s", adminTitle(admin), roleNames[admin.Role]))
+	}
+	builder.WriteString("\n\nдобавить или поменять роль: /add_admin <@username или id> <owner|host|editor>\nубрать: /remove_admin <@username или id>\n\n" +
+		"host — ведущий: очередь, оплата, статистика\neditor — редактор: сонгбук, сайт, статистика\nowner — всё, включая админов")
+	return b.SendMessage(message.Chat.ID, builder.String())
+}
+
+func (h *AdminHandlers) addAdminHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 2 || !db.IsRole(args[1]) {
+		return b.SendMessage(message.Chat.ID, "использование: /add_admin <@username или id> <owner|host|editor>")
+	}
+
+	userID, username, err := h.resolveUser(args[0])
+	if errors.Is(err, db.ErrUserNotFound) {
+		return b.SendMessage(message.Chat.ID, "не знаю такого пользователя. попросите его написать мне /whoami и добавьте по id")
+	}
+	if err != nil {
+		logger.Error(true, fmt.Sprintf("Failed to find user for admin\nUser: %s\nError: %v", args[0], err))
+		return b.SendMessage(message.Chat.ID, "случилась ошибка")
+	}
+
+	admin := db.Admin{
+		UserID:   userID,
+		Username: sql.NullString{String: username, Valid: username != ""},
+		Role:     args[1],
+		AddedBy:  sql.NullInt64{Int64: message.From.ID, Valid: true},
+	}
+	if err := h.access.Save(admin); err != nil {
+		if errors.Is(err, ErrLastOwner) {
+			return b.SendMessage(message.Chat.ID, "это последний владелец, сначала назначьте другого")
+		}
+		logger.Error(true, fmt.Sprintf("Failed to save admin\nUser ID: %d\nError: %v", userID, err))
+		return b.SendMessage(message.Chat.ID, "случилась ошибка")
+	}
+
+	logger.Info(true, fmt.Sprintf("Admin %s made %s %s", message.From.UserName, adminTitle(admin), admin.Role))
+	if err := b.SendMessage(userID, fmt.Sprintf("теперь вы админ караоке-бота, роль: %s", roleNames[admin.Role])); err != nil {
+		logger.Info(true, fmt.Sprintf("Could not tell %s about the new role, they have not started the admin bot yet", adminTitle(admin)))
+	}
+	return b.SendMessage(message.Chat.ID, fmt.Sprintf("готово: %s — %s", adminTitle(admin), roleNames[admin.Role]))
+}
+
+func (h *AdminHandlers) removeAdminHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 1 {
+		return b.SendMessage(message.Chat.ID, "использование: /remove_admin <@username или id>")
+	}
+
+	userID, _, err := h.resolveUser(args[0])
+	if err == nil {
+		err = h.access.Remove(userID)
+	}
+	switch {
+	case errors.Is(err, db.ErrUserNotFound), errors.Is(err, db.ErrAdminNotFound):
+		return b.SendMessage(message.Chat.ID, "такого админа нет, список: /admins")
+	case errors.Is(err, ErrLastOwner):
+		return b.SendMessage(message.Chat.ID, "это последний владелец, сначала назначьте другого")
+	case err != nil:
+		logger.Error(true, fmt.Sprintf("Failed to remove admin\nUser: %s\nError: %v", args[0], err))
+		return b.SendMessage(message.Chat.ID, "случилась ошибка")
+	}
+
+	logger.Info(true, fmt.Sprintf("Admin %s removed admin %s", message.From.UserName, args[0]))
+	return b.SendMessage(message.Chat.ID, fmt.Sprintf("%s больше не админ", args[0]))
+}
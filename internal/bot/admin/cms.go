@@ -16,37 +16,25 @@ import (
 )
 
 type SearchHandler struct {
-	admins         map[string]bool
-	songManager    *db.SongbookType
+	songManager    db.SongbookRepository
 	awaitingSearch map[int64]bool
 	editingSong    map[int64]string  // chatID -> songID
 	editingField   map[int64]string  // chatID -> field name
 	addingSong     map[int64]db.Song // chatID -> song
+	approving      map[int64]int64   // chatID -> ID of the song request being added
+	notifier       Notifier
 	mu             sync.RWMutex
 }
 
-var categories = map[string]string{
-	"russian_rock": "русский рок",
-	"soviet":       "советское",
-	"foreign":      "зарубежное",
-	"for_kids":     "детские песни",
-	"russian_pop":  "русская поп-музыка",
-	"different":    "разное",
-}
-
-func NewSearchHandler(adminUsernames []string, songManager *db.SongbookType) *SearchHandler {
-	admins := make(map[string]bool)
-	for _, username := range adminUsernames {
-		admins[username] = true
-	}
-
+func NewSearchHandler(songManager db.SongbookRepository, notifier Notifier) *SearchHandler {
 	return &SearchHandler{
-		admins:         admins,
 		songManager:    songManager,
 		awaitingSearch: make(map[int64]bool),
 		editingSong:    make(map[int64]string),
 		editingField:   make(map[int64]string),
 		addingSong:     make(map[int64]db.Song),
+		approving:      make(map[int64]int64),
+		notifier:       notifier,
 		mu:             sync.RWMutex{},
 	}
 }
@@ -54,24 +42,17 @@ func NewSearchHandler(adminUsernames []string, songManager *db.SongbookType) *Se
 func (h *SearchHandler) cancelAction(b *bot.Bot, update tgbotapi.Update) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
 	chatID := update.Message.Chat.ID
 	h.awaitingSearch[chatID] = false
 	delete(h.editingSong, chatID)
 	delete(h.editingField, chatID)
 	delete(h.addingSong, chatID)
+	delete(h.approving, chatID)
 	return b.SendMessage(chatID, "все действия по сонгбуку завершены")
 }
 
 func (h *SearchHandler) findSongHandler(b *bot.Bot, update tgbotapi.Update) error {
 	h.mu.Lock()
-	if !h.admins[update.Message.From.UserName] {
-		h.mu.Unlock()
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
-
 	h.awaitingSearch[update.Message.Chat.ID] = true
 	h.mu.Unlock()
 	logger.Info(true, fmt.Sprintf("Admin %s initiated song search", update.Message.From.UserName))
@@ -417,11 +398,11 @@ func (h *SearchHandler) getCurrentFieldValue(song db.Song, field string) string
 }
 
 func (h *SearchHandler) newSongHandler(b *bot.Bot, update tgbotapi.Update) error {
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(update.Message.Chat.ID, "вы не админ")
-	}
-
 	chatID := update.Message.Chat.ID
+	// a song added from scratch is not the answer to a request the admin started approving earlier
+	h.mu.Lock()
+	delete(h.approving, chatID)
+	h.mu.Unlock()
 	logger.Info(true, fmt.Sprintf("Admin %s initiated adding new song", update.Message.From.UserName))
 	if err := b.SendMessageWithMarkdown(chatID, "*скопируйте* следующее вообщение (отдним кликом по тексту) и вставьте в него данные новой песни ровно *внутрь квадрятных скобок*. не убирайте квадратные скобки, редактируйте только внтури них, звёздочкой помечены обязательные поля.\n\nп.с. в графе \"исполнитель\" пишется либо название группы либо фамилия исполнителя.", true); err != nil {
 		return err
@@ -432,10 +413,6 @@ func (h *SearchHandler) newSongHandler(b *bot.Bot, update tgbotapi.Update) error
 func (h *SearchHandler) newSongFormHandler(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
 
-	if !h.admins[update.Message.From.UserName] {
-		return b.SendMessage(chatID, "вы не админ")
-	}
-
 	song, err := parseNewSongForm(update.Message.Text)
 	if err != nil {
 		return b.SendMessage(chatID, fmt.Sprintf("ошибка при обработке формы: %v", err))
@@ -460,22 +437,11 @@ func (h *SearchHandler) requestCategoryForNewSong(b *bot.Bot, chatID int64, song
 	h.addingSong[chatID] = *song
 
 	var rows [][]tgbotapi.InlineKeyboardButton
-	categories := []struct {
-		name    string
-		display string
-	}{
-		{"russian_rock", "русский рок"},
-		{"soviet", "советское"},
-		{"foreign", "зарубежное"},
-		{"for_kids", "детские песни"},
-		{"russian_pop", "русская поп-музыка"},
-		{"different", "разное"}}
-
-	for _, category := range categories {
+	for _, category := range db.Categories {
 		row := []tgbotapi.InlineKeyboardButton{
 			tgbotapi.NewInlineKeyboardButtonData(
-				fmt.Sprint(category.display),
-				fmt.Sprintf("select_category:%s", category.name),
+				category.Name,
+				fmt.Sprintf("select_category:%s", category.Key),
 			),
 		}
 		rows = append(rows, row)
@@ -603,16 +569,17 @@ func (h *SearchHandler) handleSelectCategory(b *bot.Bot, chatID int64, category
 	if song.ID == "" {
 		return b.SendMessage(chatID, "эта кнопка уже не работает. добавьте песню заново")
 	}
-	song.Category = categories[category]
-
-	if !db.Songbook.ValidateCategory(song.Category) {
+	selected, ok := db.CategoryByKey(category)
+	if !ok {
 		return b.SendMessage(chatID, "неверная категория")
 	}
+	song.Category = selected.Name
 
 	if err := h.songManager.NewSong(song); err != nil {
 		return b.SendMessage(chatID, fmt.Sprintf("ошибка при добавлении песни: %v", err))
 	}
 	delete(h.addingSong, chatID)
+	h.resolveApprovedRequest(chatID, song)
 	logger.Info(true, fmt.Sprintf("Added new song: %s (%s)", song.Title, song.ID))
 	return b.SendMessage(chatID, fmt.Sprintf("песня добавлена \n\n%s\n\nне забудьте после всех изменений нажать /rebuild чтобы они появились на сайте", song.Stringify(false)))
 }
@@ -0,0 +1,302 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/state"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// PaymentDesk posts payment screenshots from singers to the admin chat where they are checked
+type PaymentDesk struct {
+	bot    *bot.Bot
+	chatID int64
+	price  func() int
+}
+
+// NewPaymentDesk creates a desk that sends screenshots to chatID with the admin bot
+func NewPaymentDesk(adminBot *bot.Bot, chatID int64, price func() int) *PaymentDesk {
+	return &PaymentDesk{bot: adminBot, chatID: chatID, price: price}
+}
+
+func joinIDs(entries []users.UserState) string {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, strconv.Itoa(entry.ID))
+	}
+	return strings.Join(ids, ",")
+}
+
+func parseIDs(text string) ([]int, error) {
+	var ids []int
+	for _, field := range strings.Split(text, ",") {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// SubmitPayment sends the screenshot with buttons to confirm or reject payment for the entries
+func (d *PaymentDesk) SubmitPayment(entries []users.UserState, photo []byte) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("no entries to pay for")
+	}
+	owner := entries[0]
+
+	var caption strings.Builder
+	caption.WriteString(fmt.Sprintf("💸 скриншот оплаты от %s", strings.TrimSpace(owner.TgName)))
+	if owner.Username != "" {
+		caption.WriteString(fmt.Sprintf(" (@%s)", strings.ReplaceAll(owner.Username, "\\_", "_")))
+	}
+	caption.WriteString("\n\n")
+	for _, entry := range entries {
+		caption.WriteString(fmt.Sprintf("• %s — %s\n", entry.SongName, strings.ReplaceAll(entry.TypedName, "\\_", "_")))
+	}
+	if price := d.price(); price > 0 {
+		caption.WriteString(fmt.Sprintf("\nк оплате: %d ₽", price*len(entries)))
+	}
+
+	ids := joinIDs(entries)
+	msg := tgbotapi.NewPhoto(d.chatID, tgbotapi.FileBytes{Name: "payment.jpg", Bytes: photo})
+	msg.Caption = caption.String()
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ оплачено", "pay_ok:"+ids),
+			tgbotapi.NewInlineKeyboardButtonData("❌ не нашли", "pay_reject:"+ids),
+		),
+	)
+	_, err := d.bot.Client.Send(msg)
+	return err
+}
+
+func (h *AdminHandlers) paymentCallbackHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(true, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+	}
+
+	action, idsText, _ := strings.Cut(query.Data, ":")
+	ids, err := parseIDs(idsText)
+	if err != nil {
+		return b.SendMessage(query.From.ID, "ошибка: неверный формат данных")
+	}
+
+	status, verdict := users.PaymentPaid, "✅ оплату подтвердил"
+	if action == "pay_reject" {
+		status, verdict = users.PaymentRejected, "❌ оплату отклонил"
+	}
+
+	updated, alreadyPaid, err := h.userManager.SetPayment(context.Background(), ids, status)
+	if err != nil {
+		return b.SendMessage(query.From.ID, "случилась ошибка при сохранении оплаты")
+	}
+
+	if len(alreadyPaid) > 0 {
+		names := make([]string, 0, len(alreadyPaid))
+		for _, entry := range alreadyPaid {
+			names = append(names, fmt.Sprintf("%s «%s»", strings.ReplaceAll(entry.TypedName, "\\_", "_"), entry.SongName))
+		}
+		if err := b.SendMessage(query.From.ID, "уже оплачено, статус не менял: "+strings.Join(names, ", ")); err != nil {
+			logger.Error(true, fmt.Sprintf(" Failed to report paid entries\nAdmin: %s\nError: %v", query.From.UserName, err))
+		}
+	}
+
+	if len(updated) == 0 && len(alreadyPaid) > 0 {
+		verdict = "эти записи уже оплачены, ничего не менял"
+	} else if len(updated) == 0 {
+		verdict = "этих записей уже нет в очереди, проверил"
+	} else if status == users.PaymentPaid {
+		h.notifier.Notify(updated[0].ChatID, "оплата подтверждена, спасибо! 🎉")
+	} else {
+		h.notifier.Notify(updated[0].ChatID, "админы не нашли ваш перевод. проверьте, пожалуйста, и пришлите скриншот ещё раз или подойдите к ведущему")
+	}
+
+	logger.Info(true, fmt.Sprintf("Admin %s set payment %q for entries %s", query.From.UserName, status, idsText))
+	edit := tgbotapi.NewEditMessageCaption(query.Message.Chat.ID, query.Message.MessageID,
+		fmt.Sprintf("%s\n\n%s @%s", query.Message.Caption, verdict, query.From.UserName))
+	if _, err := b.Client.Send(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return err
+	}
+	return nil
+}
+
+// holdUnpaidHandler switches whether unpaid entries wait outside the queue until their payment is confirmed
+func (h *AdminHandlers) holdUnpaidHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	var hold bool
+	switch strings.TrimSpace(message.CommandArguments()) {
+	case "on":
+		hold = true
+	case "off":
+		hold = false
+	default:
+		state := "выключено: неоплаченные записи стоят в очереди как обычно"
+		if h.userManager.GetHoldUnpaid() {
+			state = "включено: записи попадают в очередь, только когда оплата подтверждена"
+		}
+		return b.SendMessage(message.Chat.ID, fmt.Sprintf("%s\n\nиспользование: /hold_unpaid on|off", state))
+	}
+
+	if err := h.userManager.SetHoldUnpaid(context.Background(), hold); err != nil {
+		return b.SendMessage(message.Chat.ID, "случилась ошибка")
+	}
+	logger.Info(true, fmt.Sprintf("Admin %s set hold unpaid to %t", message.From.UserName, hold))
+	if hold {
+		return b.SendMessage(message.Chat.ID, "теперь неоплаченные записи ждут подтверждения оплаты и не попадают в очередь (работает, только когда караоке платное)")
+	}
+	return b.SendMessage(message.Chat.ID, "неоплаченные записи снова стоят в очереди как обычно")
+}
+
+// paymentMethodsMessage lists the payment methods with a delete button for each, the text is markdown
+func (h *AdminHandlers) paymentMethodsMessage() (string, tgbotapi.InlineKeyboardMarkup) {
+	methods := h.userManager.GetPaymentMethods()
+
+	var builder strings.Builder
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(methods) == 0 {
+		builder.WriteString("способов оплаты пока нет, певцам скажем, что как оплатить, подскажет ведущий")
+	} else {
+		builder.WriteString("так певцы видят, куда переводить деньги:\n")
+	}
+	for _, method := range methods {
+		builder.WriteString(fmt.Sprintf("\n• %s: %s", tgbotapi.EscapeText(tgbotapi.ModeMarkdown, method.Name), tgbotapi.EscapeText(tgbotapi.ModeMarkdown, method.Details)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 %s", method.Name), "paymethod_del:"+method.Key()),
+		))
+	}
+	if price := h.userManager.GetPrice(); price == 0 {
+		builder.WriteString("\n\nсейчас караоке бесплатное, цена меняется командой /change_price")
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ добавить способ", "paymethod_add"),
+	))
+	return builder.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func paymentMethodCancelKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ отмена", "paymethod_cancel"),
+		),
+	)
+}
+
+func (h *AdminHandlers) paymentMethodsHandler(b *bot.Bot, update tgbotapi.Update) error {
+	text, keyboard := h.paymentMethodsMessage()
+	return b.SendMessageWithButtonsNoLinks(update.Message.Chat.ID, text, keyboard)
+}
+
+func (h *AdminHandlers) paymentMethodCallbackHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(true, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+	}
+
+	chatID := query.Message.Chat.ID
+	action, key, _ := strings.Cut(query.Data, ":")
+	switch action {
+	case "paymethod_add":
+		h.mu.Lock()
+		h.paymentMethodDrafts[chatID] = &state.PaymentMethod{}
+		h.mu.Unlock()
+		return b.SendMessageWithButtons(chatID, "как называется способ оплаты? например «сбп» или «тинькофф по ссылке»", paymentMethodCancelKeyboard())
+	case "paymethod_cancel":
+		h.mu.Lock()
+		delete(h.paymentMethodDrafts, chatID)
+		h.mu.Unlock()
+		return b.SendMessage(chatID, "ок, ничего не меняем")
+	case "paymethod_del":
+		removed, found, err := h.userManager.RemovePaymentMethod(context.Background(), key)
+		if err != nil {
+			return b.SendMessage(chatID, "случилась ошибка")
+		}
+		if !found {
+			return b.SendMessage(chatID, "этого способа уже нет, откройте /payment_methods ещё раз")
+		}
+		logger.Info(true, fmt.Sprintf("Admin %s removed payment method %s", query.From.UserName, removed.Name))
+
+		text, keyboard := h.paymentMethodsMessage()
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, text, keyboard)
+		edit.ParseMode = "Markdown"
+		edit.DisableWebPagePreview = true
+		if _, err := b.Client.Send(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+			return err
+		}
+		return nil
+	}
+	return b.SendMessage(chatID, "неизвестная команда")
+}
+
+// handlePaymentMethodInput collects the name and then the details of a new payment method
+func (h *AdminHandlers) handlePaymentMethodInput(b *bot.Bot, update tgbotapi.Update) error {
+	if update.Message == nil {
+		return nil
+	}
+	chatID := update.Message.Chat.ID
+
+	h.mu.Lock()
+	draft, exists := h.paymentMethodDrafts[chatID]
+	h.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	if h.access.stopDialog(b, update, PermPayments) {
+		h.mu.Lock()
+		delete(h.paymentMethodDrafts, chatID)
+		h.mu.Unlock()
+		return bot.ErrMessageHandled
+	}
+
+	text := strings.TrimSpace(update.Message.Text)
+	if text == "" {
+		if err := b.SendMessage(chatID, "нужно написать текстом"); err != nil {
+			return err
+		}
+		return bot.ErrMessageHandled
+	}
+
+	h.mu.Lock()
+	askingName := draft.Name == ""
+	if askingName {
+		draft.Name = text
+	} else {
+		draft.Details = text
+		delete(h.paymentMethodDrafts, chatID)
+	}
+	h.mu.Unlock()
+
+	if askingName {
+		if err := b.SendMessageWithButtons(chatID, "пришлите реквизиты: ссылку или номер телефона с именем получателя", paymentMethodCancelKeyboard()); err != nil {
+			return err
+		}
+		return bot.ErrMessageHandled
+	}
+
+	methods := append(h.userManager.GetPaymentMethods(), *draft)
+	if err := h.userManager.SetPaymentMethods(context.Background(), methods); err != nil {
+		if err := b.SendMessage(chatID, "случилась ошибка при сохранении"); err != nil {
+			return err
+		}
+		return bot.ErrMessageHandled
+	}
+	logger.Info(true, fmt.Sprintf("Admin %s added payment method %s", update.Message.From.UserName, draft.Name))
+
+	listText, keyboard := h.paymentMethodsMessage()
+	if err := b.SendMessageWithButtonsNoLinks(chatID, "добавлено!\n\n"+listText, keyboard); err != nil {
+		return err
+	}
+	return bot.ErrMessageHandled
+}
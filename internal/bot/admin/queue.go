@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/bot/common"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+func stageKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️ следующий", "queue_next"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ спел(а)", "queue_done"),
+			tgbotapi.NewInlineKeyboardButtonData("⏭ пропустить", "queue_skip"),
+			tgbotapi.NewInlineKeyboardButtonData("🚫 не пришёл", "queue_noshow"),
+		),
+	)
+}
+
+func stageMessage(current users.UserState, waiting []users.UserState) string {
+	text := fmt.Sprintf("🎤 на сцене: *%s*\nпесня: %s", current.TypedName, common.FormatSong(current))
+	if current.SongNote != "" {
+		text += fmt.Sprintf("\nзаметка по песне: %s", current.SongNote)
+	}
+	if len(waiting) > 0 {
+		text += fmt.Sprintf("\n\nследующий: %s — %s", waiting[0].TypedName, waiting[0].SongName)
+	} else {
+		text += "\n\nбольше в очереди никого нет"
+	}
+	return text
+}
+
+// sendStage reports who is on stage now together with the queue control buttons
+func (h *AdminHandlers) sendStage(b *bot.Bot, chatID int64) error {
+	current, performing := h.userManager.GetCurrent()
+	if !performing {
+		waiting := h.userManager.GetQueue()
+		if len(waiting) == 0 {
+			return b.SendMessage(chatID, "на сцене никого нет, в очереди тоже пусто")
+		}
+		return b.SendMessageWithButtons(chatID,
+			fmt.Sprintf("на сцене никого нет. в очереди: %d", len(waiting)),
+			tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData("▶️ позвать следующего", "queue_next"),
+				),
+			),
+		)
+	}
+	return b.SendMessageWithButtons(chatID, stageMessage(current, h.userManager.GetQueue()), stageKeyboard())
+}
+
+func (h *AdminHandlers) nowHandler(b *bot.Bot, update tgbotapi.Update) error {
+	return h.sendStage(b, update.Message.Chat.ID)
+}
+
+func (h *AdminHandlers) nextHandler(b *bot.Bot, update tgbotapi.Update) error {
+	return h.callNext(b, update.Message.Chat.ID, update.Message.From.UserName)
+}
+
+func (h *AdminHandlers) callNext(b *bot.Bot, chatID int64, adminUsername string) error {
+	ctx := context.Background()
+	next, found, err := h.userManager.CallNext(ctx)
+	if err != nil {
+		return b.SendMessage(chatID, "случилась ошибка")
+	}
+	if !found {
+		logger.Info(true, fmt.Sprintf("Admin %s called next singer, but the line is empty", adminUsername))
+		return b.SendMessage(chatID, "очередь закончилась, больше никого нет")
+	}
+	logger.Info(true, fmt.Sprintf("Admin %s called %s (%s) to the stage", adminUsername, next.TypedName, next.SongName))
+	return b.SendMessageWithButtons(chatID, stageMessage(next, h.userManager.GetQueue()), stageKeyboard())
+}
+
+func (h *AdminHandlers) queueCallbackHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+	}
+
+	chatID := query.Message.Chat.ID
+	var stage string
+	switch query.Data {
+	case "queue_next":
+		return h.callNext(b, chatID, query.From.UserName)
+	case "queue_done":
+		stage = users.StagePerformed
+	case "queue_skip":
+		stage = users.StageSkipped
+	case "queue_noshow":
+		stage = users.StageNoShow
+	default:
+		return b.SendMessage(chatID, "неизвестная команда")
+	}
+
+	ctx := context.Background()
+	finished, found, err := h.userManager.FinishCurrent(ctx, stage)
+	if err != nil {
+		return b.SendMessage(chatID, "случилась ошибка")
+	}
+	if !found {
+		return b.SendMessage(chatID, "на сцене сейчас никого нет")
+	}
+	logger.Info(true, fmt.Sprintf("Admin %s marked %s (%s) as %s", query.From.UserName, finished.TypedName, finished.SongName, stage))
+
+	if stage == users.StagePerformed {
+		return h.sendStage(b, chatID)
+	}
+	return h.callNext(b, chatID, query.From.UserName)
+}
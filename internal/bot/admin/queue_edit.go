@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/state"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// queueEditorSize is how many entries get their own row of buttons, telegram limits keyboard size
+const queueEditorSize = 20
+
+type WalkInState struct {
+	name string
+}
+
+func (h *AdminHandlers) queueEditor() (string, tgbotapi.InlineKeyboardMarkup) {
+	queue := h.userManager.GetQueue()
+
+	var builder strings.Builder
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(queue) == 0 {
+		builder.WriteString("в очереди никого нет")
+	} else {
+		builder.WriteString("очередь:\n\n")
+	}
+
+	for i, entry := range queue {
+		if i >= queueEditorSize {
+			builder.WriteString(fmt.Sprintf("\n...и ещё %d (кнопки только для первых %d)", len(queue)-i, queueEditorSize))
+			break
+		}
+		builder.WriteString(fmt.Sprintf("%d. %s — %s\n", i+1, entry.TypedName, entry.SongName))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⬆️ %d", i+1), fmt.Sprintf("qedit_up:%d", entry.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⬇️ %d", i+1), fmt.Sprintf("qedit_down:%d", entry.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⏫ %d", i+1), fmt.Sprintf("qedit_top:%d", entry.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("❌ %d", i+1), fmt.Sprintf("qedit_remove:%d", entry.ID)),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ добавить без телеграма", "qedit_walkin"),
+		tgbotapi.NewInlineKeyboardButtonData("🔄 обновить", "qedit_refresh"),
+	))
+
+	return builder.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (h *AdminHandlers) editQueueMessage(b *bot.Bot, chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ReplyMarkup = &keyboard
+	editMsg.ParseMode = "Markdown"
+	editMsg.DisableWebPagePreview = true
+
+	_, err := b.Client.Send(editMsg)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+func (h *AdminHandlers) queueEditorHandler(b *bot.Bot, update tgbotapi.Update) error {
+	text, keyboard := h.queueEditor()
+	return b.SendMessageWithButtons(update.Message.Chat.ID, text, keyboard)
+}
+
+func (h *AdminHandlers) queueEditCallbackHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+	}
+
+	chatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+	parts := strings.SplitN(query.Data, ":", 2)
+	action := parts[0]
+
+	switch action {
+	case "qedit_refresh":
+		text, keyboard := h.queueEditor()
+		return h.editQueueMessage(b, chatID, messageID, text, keyboard)
+	case "qedit_walkin":
+		return h.startWalkIn(b, chatID)
+	case "qedit_walkin_cancel":
+		h.mu.Lock()
+		delete(h.walkIns, chatID)
+		h.mu.Unlock()
+		return b.SendMessage(chatID, "ок, никого не добавляем")
+	}
+
+	if len(parts) != 2 {
+		return b.SendMessage(chatID, "ошибка: неверный формат данных")
+	}
+	stateID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return b.SendMessage(chatID, "ошибка: неверный формат данных")
+	}
+	entry, found := h.userManager.Get(stateID)
+	if !found || entry.Stage != users.StageInLine {
+		text, keyboard := h.queueEditor()
+		if err := h.editQueueMessage(b, chatID, messageID, text, keyboard); err != nil {
+			return err
+		}
+		return b.SendMessage(chatID, "этой записи уже нет в очереди")
+	}
+
+	ctx := context.Background()
+	switch action {
+	case "qedit_up":
+		err = h.userManager.MoveUp(ctx, stateID)
+	case "qedit_down":
+		err = h.userManager.MoveDown(ctx, stateID)
+	case "qedit_top":
+		err = h.userManager.MoveToTop(ctx, stateID)
+	case "qedit_remove":
+		return h.editQueueMessage(b, chatID, messageID,
+			fmt.Sprintf("удалить из очереди %s — %s?", entry.TypedName, entry.SongName),
+			tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData("да, удалить", fmt.Sprintf("qedit_remove_yes:%d", stateID)),
+					tgbotapi.NewInlineKeyboardButtonData("нет", "qedit_refresh"),
+				),
+			),
+		)
+	case "qedit_remove_yes":
+		err = h.userManager.RemoveState(ctx, stateID)
+	default:
+		return b.SendMessage(chatID, "неизвестная команда")
+	}
+
+	if errors.Is(err, state.ErrOrderingConflict) {
+		if h.userManager.GetOrdering() == state.OrderingRoundRobin {
+			return b.SendMessage(chatID, "в режиме очереди по кругу так не переставить: запись окажется в другом круге. используйте ⏫ или смените режим в /limit")
+		}
+		return b.SendMessage(chatID, "так не переставить, обновите список и попробуйте ещё раз")
+	}
+	if err != nil {
+		logger.Error(true, fmt.Sprintf("Failed to edit queue\nAdmin: %s\nAction: %s\nState ID: %d\nError: %v", query.From.UserName, action, stateID, err))
+		return b.SendMessage(chatID, "случилась ошибка")
+	}
+	logger.Info(true, fmt.Sprintf("Admin %s applied %s to %s (%s)", query.From.UserName, action, entry.TypedName, entry.SongName))
+
+	text, keyboard := h.queueEditor()
+	return h.editQueueMessage(b, chatID, messageID, text, keyboard)
+}
+
+func (h *AdminHandlers) walkInHandler(b *bot.Bot, update tgbotapi.Update) error {
+	return h.startWalkIn(b, update.Message.Chat.ID)
+}
+
+func (h *AdminHandlers) startWalkIn(b *bot.Bot, chatID int64) error {
+	h.mu.Lock()
+	h.walkIns[chatID] = &WalkInState{}
+	h.mu.Unlock()
+	return b.SendMessageWithButtons(chatID, "как зовут певца/певцов?", walkInCancelKeyboard())
+}
+
+func walkInCancelKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ отмена", "qedit_walkin_cancel"),
+		),
+	)
+}
+
+func (h *AdminHandlers) handleWalkInInput(b *bot.Bot, update tgbotapi.Update) error {
+	if update.Message == nil {
+		return nil
+	}
+	chatID := update.Message.Chat.ID
+
+	h.mu.Lock()
+	walkIn, exists := h.walkIns[chatID]
+	h.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	if h.access.stopDialog(b, update, PermRunLine) {
+		h.mu.Lock()
+		delete(h.walkIns, chatID)
+		h.mu.Unlock()
+		return bot.ErrMessageHandled
+	}
+
+	text := strings.TrimSpace(update.Message.Text)
+	if text == "" {
+		if err := b.SendMessage(chatID, "нужно написать текстом"); err != nil {
+			return err
+		}
+		return bot.ErrMessageHandled
+	}
+
+	h.mu.Lock()
+	askingName := walkIn.name == ""
+	if askingName {
+		walkIn.name = text
+	}
+	h.mu.Unlock()
+
+	if askingName {
+		if err := b.SendMessageWithButtons(chatID,
+			"что будет петь? пришлите id песни из сонгбука или просто название",
+			walkInCancelKeyboard()); err != nil {
+			return err
+		}
+		return bot.ErrMessageHandled
+	}
+
+	h.mu.Lock()
+	delete(h.walkIns, chatID)
+	h.mu.Unlock()
+
+	entry := users.UserState{
+		TgName:    walkIn.name,
+		TypedName: strings.ReplaceAll(walkIn.name, "_", "\\_"),
+		SongName:  text,
+	}
+	if song, found := db.Songbook.FindSongByID(text); found {
+		entry.SongID = song.ID
+		entry.SongName = db.Songbook.FormatSongName(song)
+		entry.SongLink = song.Link
+		entry.SongNote = song.AdditionalChords.String
+		if err := db.Songbook.IncrementSongCounter(song.ID); err != nil {
+			logger.Error(true, fmt.Sprintf(" Failed to increment song counter\nSong ID: %s\nError: %v", song.ID, err))
+		}
+	}
+
+	ctx := context.Background()
+	added, err := h.userManager.AddWalkIn(ctx, entry)
+	if err != nil {
+		if err := b.SendMessage(chatID, "случилась ошибка, никого не добавили"); err != nil {
+			return err
+		}
+		return bot.ErrMessageHandled
+	}
+
+	position, _ := h.userManager.Position(added.ID)
+	logger.Info(true, fmt.Sprintf("Admin %s added walk-in %s with song %s", update.Message.From.UserName, added.TypedName, added.SongName))
+	if err := b.SendMessage(chatID, fmt.Sprintf("%s добавлен(а) в очередь с песней «%s», место в очереди: %d\n\nпоменять порядок: /queue", walkIn.name, added.SongName, position)); err != nil {
+		return err
+	}
+	return bot.ErrMessageHandled
+}
@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+// requestsListSize is how many pending requests get their own buttons
+const requestsListSize = 15
+
+// Notifier reaches singers through the client bot
+type Notifier interface {
+	Notify(chatID int64, text string)
+}
+
+func requestTitle(request db.SongRequest) string {
+	return fmt.Sprintf("%s — %s", request.Artist, request.Title)
+}
+
+// newSongForm is the /newsongform message filled in with what the singer asked for
+func newSongForm(request db.SongRequest) string {
+	return fmt.Sprintf("/newsongform\n\nисполнитель - [%s]*\nимя исполниеля - []\nназвание песни - [%s]*\nссылка на аккорды - [%s]*",
+		request.Artist, request.Title, request.Link.String)
+}
+
+func (h *SearchHandler) requestsHandler(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	requests, err := db.SongRequests.Pending()
+	if err != nil {
+		logger.Error(true, fmt.Sprintf("Failed to load song requests\nError: %v", err))
+		return b.SendMessage(chatID, "не получилось загрузить заявки")
+	}
+	if len(requests) == 0 {
+		return b.SendMessage(chatID, "новых заявок на песни нет")
+	}
+
+	var builder strings.Builder
+	var rows [][]tgbotapi.InlineKeyboardButton
+	builder.WriteString("заявки на песни:\n\n")
+	for i, request := range requests {
+		if i >= requestsListSize {
+			builder.WriteString(fmt.Sprintf("...и ещё %d", len(requests)-i))
+			break
+		}
+		from := "без ника"
+		if request.Username.Valid {
+			from = "@" + request.Username.String
+		}
+		builder.WriteString(fmt.Sprintf("%d. %s (%s, %s)\n", i+1, requestTitle(request), from, request.CreatedAt.Format("02.01")))
+		if request.Link.Valid {
+			builder.WriteString(fmt.Sprintf("   %s\n", request.Link.String))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("✅ %d", i+1), fmt.Sprintf("req_approve:%d", request.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("❌ %d", i+1), fmt.Sprintf("req_reject:%d", request.ID)),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, builder.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	msg.DisableWebPagePreview = true
+	_, err = b.Client.Send(msg)
+	return err
+}
+
+func (h *SearchHandler) requestCallbackHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	chatID := query.Message.Chat.ID
+	action, idText, _ := strings.Cut(query.Data, ":")
+	requestID, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		return b.SendMessage(chatID, "ошибка: неверный формат данных")
+	}
+	request, err := db.SongRequests.Get(requestID)
+	if err != nil {
+		logger.Error(true, fmt.Sprintf("Failed to load song request\nRequest ID: %d\nError: %v", requestID, err))
+		return b.SendMessage(chatID, "заявка не найдена")
+	}
+	if request.Status != db.RequestPending {
+		return b.SendMessage(chatID, "эту заявку уже разобрали")
+	}
+
+	switch action {
+	case "req_reject":
+		if err := db.SongRequests.Resolve(request.ID, db.RequestRejected, ""); err != nil {
+			logger.Error(true, fmt.Sprintf("Failed to reject song request\nRequest ID: %d\nError: %v", request.ID, err))
+			return b.SendMessage(chatID, "случилась ошибка")
+		}
+		logger.Info(true, fmt.Sprintf("Admin %s rejected song request %s", query.From.UserName, requestTitle(request)))
+		h.notifier.Notify(request.ChatID, fmt.Sprintf("к сожалению, песню «%s» пока не добавим в сонгбук. но вы можете выбрать другую!", requestTitle(request)))
+		return b.SendMessage(chatID, fmt.Sprintf("заявка «%s» отклонена, певцу отправлено сообщение", requestTitle(request)))
+	case "req_approve":
+		return h.approveRequest(b, chatID, query.From.UserName, request)
+	}
+	return b.SendMessage(chatID, "неизвестная команда")
+}
+
+// approveRequest starts adding the requested song: the admin gets a filled in /newsongform to fix
+// and, when the singer sent a link, the category picker right away.
+// The request is marked approved once the song is actually added.
+func (h *SearchHandler) approveRequest(b *bot.Bot, chatID int64, adminUsername string, request db.SongRequest) error {
+	h.mu.Lock()
+	h.approving[chatID] = request.ID
+	h.mu.Unlock()
+
+	logger.Info(true, fmt.Sprintf("Admin %s is adding requested song %s", adminUsername, requestTitle(request)))
+
+	msg := tgbotapi.NewMessage(chatID, "поправьте, если нужно, и отправьте эту форму (или /cancel):")
+	if _, err := b.Client.Send(msg); err != nil {
+		return err
+	}
+	msg = tgbotapi.NewMessage(chatID, newSongForm(request))
+	msg.DisableWebPagePreview = true
+	if _, err := b.Client.Send(msg); err != nil {
+		return err
+	}
+
+	if !request.Link.Valid {
+		return b.SendMessage(chatID, "певец не прислал ссылку на аккорды, без неё песню не добавить")
+	}
+
+	song := &db.Song{
+		ID:        generateRandomID(),
+		Title:     request.Title,
+		Artist:    sql.NullString{String: request.Artist, Valid: request.Artist != ""},
+		Link:      request.Link.String,
+		CreatedAt: time.Now().Unix(),
+	}
+	return h.requestCategoryForNewSong(b, chatID, song)
+}
+
+// resolveApprovedRequest marks the request the admin was adding as approved and tells the singer.
+// Must be called with the lock held.
+func (h *SearchHandler) resolveApprovedRequest(chatID int64, song db.Song) {
+	requestID, ok := h.approving[chatID]
+	if !ok {
+		return
+	}
+	delete(h.approving, chatID)
+
+	request, err := db.SongRequests.Get(requestID)
+	if err == nil {
+		err = db.SongRequests.Resolve(requestID, db.RequestApproved, song.ID)
+	}
+	if err != nil {
+		logger.Error(true, fmt.Sprintf("Failed to approve song request\nRequest ID: %d\nError: %v", requestID, err))
+		return
+	}
+	h.notifier.Notify(request.ChatID, fmt.Sprintf("ура! песню «%s» добавили в сонгбук 🎉\nчтобы записаться, просто напишите мне её название", h.songManager.FormatSongName(song)))
+}
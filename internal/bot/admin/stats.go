@@ -0,0 +1,206 @@
+package admin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+const statsTopSize = 5
+
+type statsCount struct {
+	name  string
+	count int
+}
+
+// topCounts sorts the counters by value and keeps the first limit of them
+func topCounts(counters map[string]int, limit int) []statsCount {
+	var result []statsCount
+	for name, count := range counters {
+		result = append(result, statsCount{name, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].name < result[j].name
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func writeCounts(builder *strings.Builder, title string, counts []statsCount) {
+	if len(counts) == 0 {
+		return
+	}
+	builder.WriteString(title + "\n")
+	for i, count := range counts {
+		builder.WriteString(fmt.Sprintf("%d. %s — %d\n", i+1, count.name, count.count))
+	}
+	builder.WriteString("\n")
+}
+
+func (h *AdminHandlers) nightStats() string {
+	entries := h.userManager.GetAll()
+	price := h.userManager.GetPrice()
+
+	songs := make(map[string]int)
+	singers := make(map[string]int)
+	hours := make(map[int]int)
+	stages := make(map[string]int)
+	moscowLocation := time.FixedZone("Moscow Time", 3*60*60)
+
+	for _, entry := range entries {
+		if entry.Stage == users.StageAskingName {
+			continue
+		}
+		stages[entry.Stage]++
+		songs[entry.SongName]++
+		singers[strings.ReplaceAll(entry.TypedName, "\\_", "_")]++
+		hours[entry.TimeAdded.In(moscowLocation).Hour()]++
+	}
+
+	total := 0
+	for _, count := range stages {
+		total += count
+	}
+	if total == 0 {
+		return "📊 сегодня пока никто не записался"
+	}
+
+	var builder strings.Builder
+	builder.WriteString("📊 сегодня\n\n")
+	builder.WriteString(fmt.Sprintf("записей: %d (в очереди %d, спели %d, пропущено %d)\n\n",
+		total,
+		stages[users.StageInLine],
+		stages[users.StagePerformed]+stages[users.StagePerforming],
+		stages[users.StageSkipped]+stages[users.StageNoShow],
+	))
+
+	writeCounts(&builder, "топ песен вечера:", topCounts(songs, statsTopSize))
+	writeCounts(&builder, "топ певцов вечера:", topCounts(singers, statsTopSize))
+
+	// the night goes past midnight, so hours are listed starting from the evening
+	var hourKeys []int
+	for hour := range hours {
+		hourKeys = append(hourKeys, hour)
+	}
+	sort.Slice(hourKeys, func(i, j int) bool { return (hourKeys[i]+12)%24 < (hourKeys[j]+12)%24 })
+	builder.WriteString("записи по часам:\n")
+	for _, hour := range hourKeys {
+		builder.WriteString(fmt.Sprintf("%02d:00 — %d %s\n", hour, hours[hour], strings.Repeat("▇", hours[hour])))
+	}
+	builder.WriteString("\n")
+
+	if price > 0 {
+		performed := stages[users.StagePerformed] + stages[users.StagePerforming]
+		builder.WriteString(fmt.Sprintf("выручка: %d × %d ₽ = %d ₽", performed, price, performed*price))
+		if waiting := stages[users.StageInLine]; waiting > 0 {
+			builder.WriteString(fmt.Sprintf(" (и ещё до %d ₽ за тех, кто в очереди)", waiting*price))
+		}
+	} else {
+		builder.WriteString("сегодня бесплатно, выручки нет")
+	}
+
+	return builder.String()
+}
+
+func (h *AdminHandlers) allTimeStats() (string, error) {
+	var builder strings.Builder
+	builder.WriteString("📈 за всё время\n\n")
+
+	topSongs := make([]statsCount, 0, statsTopSize)
+	for _, song := range db.Songbook.TopSongs(statsTopSize) {
+		topSongs = append(topSongs, statsCount{db.Songbook.FormatSongName(song), song.Counter})
+	}
+	writeCounts(&builder, "топ песен:", topSongs)
+
+	performers, err := db.Users.TopPerformers(statsTopSize)
+	if err != nil {
+		return "", err
+	}
+	topSingers := make([]statsCount, 0, len(performers))
+	for _, user := range performers {
+		name := user.SavedName.String
+		if name == "" {
+			name = user.TgName.String
+		}
+		if user.Username.Valid {
+			name = fmt.Sprintf("%s (@%s)", name, user.Username.String)
+		}
+		topSingers = append(topSingers, statsCount{strings.ReplaceAll(name, "\\_", "_"), user.TimesPerformed})
+	}
+	writeCounts(&builder, "топ певцов:", topSingers)
+
+	writeCounts(&builder, "по категориям:", topCounts(db.Songbook.CategoryCounters(), 0))
+
+	neverSung := db.Songbook.NeverSung()
+	if len(neverSung) == 0 {
+		builder.WriteString("все песни из сонгбука хоть раз да пели")
+	} else {
+		names := make([]string, 0, len(neverSung))
+		for _, song := range neverSung {
+			names = append(names, db.Songbook.FormatSongName(song))
+		}
+		sort.Strings(names)
+		builder.WriteString(fmt.Sprintf("ни разу не пели: %d песен\n", len(names)))
+		for i, name := range names {
+			if i >= 15 {
+				builder.WriteString(fmt.Sprintf("...и ещё %d", len(names)-i))
+				break
+			}
+			builder.WriteString(fmt.Sprintf("• %s\n", name))
+		}
+	}
+
+	return builder.String(), nil
+}
+
+func (h *AdminHandlers) statsHandler(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	logger.Info(true, fmt.Sprintf("Admin %s requested stats", update.Message.From.UserName))
+
+	if err := b.SendMessage(chatID, h.nightStats()); err != nil {
+		return err
+	}
+
+	allTime, err := h.allTimeStats()
+	if err != nil {
+		logger.Error(true, fmt.Sprintf("Failed to collect all-time stats\nError: %v", err))
+		return b.SendMessage(chatID, "не получилось посчитать статистику за всё время")
+	}
+	return b.SendMessage(chatID, allTime)
+}
+
+// metricsHandler shows how often each command was used since the start and how it went
+func (h *AdminHandlers) metricsHandler(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	if h.metrics == nil {
+		return b.SendMessage(chatID, "метрики не собираются")
+	}
+
+	routes, since := h.metrics.Snapshot()
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📈 с %s:\n", since.In(time.Local).Format("02.01 15:04")))
+	if len(routes) == 0 {
+		sb.WriteString("\nпока ничего не было")
+	}
+	for _, route := range routes {
+		average := route.Total / time.Duration(route.Calls)
+		sb.WriteString(fmt.Sprintf("\n%s — %d, в среднем %s, максимум %s",
+			route.Route, route.Calls, average.Round(time.Millisecond), route.Slowest.Round(time.Millisecond)))
+		if route.Errors > 0 {
+			sb.WriteString(fmt.Sprintf(", ошибок %d", route.Errors))
+		}
+	}
+	return b.SendMessage(chatID, sb.String())
+}
@@ -21,12 +21,32 @@ type Bot struct {
 	stopChan   chan struct{}
 	name       string
 	mu         sync.Mutex
+	// inlineHandler answers inline queries, bots without one ignore them
+	inlineHandler func(b *Bot, update tgbotapi.Update) error
+	// preCheckoutHandler confirms payments before they are taken, paymentHandler gets the successful ones
+	preCheckoutHandler func(b *Bot, update tgbotapi.Update) error
+	paymentHandler     func(b *Bot, update tgbotapi.Update) error
+	// middleware wraps every handler, see Use
+	middleware []Middleware
+	// commands and callbacks are the handlers passed to Start
+	commands  map[string]HandlerFunc
+	callbacks map[string]HandlerFunc
 }
 
 // New creates a new bot instance
 func New(name, token string) (*Bot, error) {
+	return NewWithEndpoint(name, token, "")
+}
+
+// NewWithEndpoint creates a bot talking to another Bot API server, such as a local one or a stub in tests.
+// The endpoint is a format string like tgbotapi.APIEndpoint, empty means the official server.
+func NewWithEndpoint(name, token, endpoint string) (*Bot, error) {
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+
 	// Create bot client
-	botClient, err := tgbotapi.NewBotAPI(token)
+	botClient, err := tgbotapi.NewBotAPIWithAPIEndpoint(token, endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -44,71 +64,157 @@ func New(name, token string) (*Bot, error) {
 	}, nil
 }
 
-// Start begins processing updates with custom handler
+// Use adds middleware that wraps every handler of the bot, the first one added runs first.
+// Call it before Start.
+func (b *Bot) Use(middleware ...Middleware) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.middleware = append(b.middleware, middleware...)
+}
+
+// Start begins processing updates with custom handler.
+// Routes attach extra middleware to some of the commands and callbacks, such as access checks.
 func (b *Bot) Start(
 	commandHandlers map[string]func(b *Bot, update tgbotapi.Update) error,
 	messageHandlers []func(b *Bot, update tgbotapi.Update) error,
 	callbackHandlers map[string]func(b *Bot, update tgbotapi.Update) error,
+	routes ...Route,
 ) {
-	logger.Info(strings.Contains(b.name, "Admin"), fmt.Sprintf("%s authorized on account %s", b.name, b.Client.Self.UserName))
+	logger.Info(b.isAdmin(), fmt.Sprintf("%s authorized on account %s", b.name, b.Client.Self.UserName))
+
+	commands := b.applyRoutes("command", commandHandlers, routes, func(r Route) []string { return r.Commands })
+	callbacks := b.applyRoutes("callback", callbackHandlers, routes, func(r Route) []string { return r.Callbacks })
+	b.mu.Lock()
+	b.commands, b.callbacks = commands, callbacks
+	b.mu.Unlock()
 
 	for {
 		select {
 		case update := <-b.updateChan:
-			go b.processUpdate(update, commandHandlers, messageHandlers, callbackHandlers)
+			go b.processUpdate(update, commands, messageHandlers, callbacks)
 		case <-b.stopChan:
 			return
 		}
 	}
 }
 
-// processUpdate handles incoming updates with custom handlers
+// applyRoutes wraps the handlers named by the routes with their middleware
+func (b *Bot) applyRoutes(
+	kind string,
+	handlers map[string]func(b *Bot, update tgbotapi.Update) error,
+	routes []Route,
+	names func(Route) []string,
+) map[string]HandlerFunc {
+	wrapped := make(map[string]HandlerFunc, len(handlers))
+	for name, handler := range handlers {
+		wrapped[name] = handler
+	}
+	for _, route := range routes {
+		for _, name := range names(route) {
+			handler, ok := wrapped[name]
+			if !ok {
+				logger.Error(b.isAdmin(), fmt.Sprintf("[%s] route for unknown %s %q", b.name, kind, name))
+				continue
+			}
+			wrapped[name] = Chain(handler, route.Middleware...)
+		}
+	}
+	return wrapped
+}
+
+// SetInlineHandler makes the bot answer inline queries (@bot <query>) with handler.
+// Inline mode must also be switched on for the bot in BotFather.
+func (b *Bot) SetInlineHandler(handler func(b *Bot, update tgbotapi.Update) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inlineHandler = handler
+}
+
+// SetPaymentHandlers makes the bot take payments for its invoices: preCheckout must answer
+// every pre-checkout query within 10 seconds, payment is called for each successful payment
+func (b *Bot) SetPaymentHandlers(preCheckout, payment func(b *Bot, update tgbotapi.Update) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.preCheckoutHandler = preCheckout
+	b.paymentHandler = payment
+}
+
+// processUpdate runs the handler for the update wrapped in the bot middleware
 func (b *Bot) processUpdate(
 	update tgbotapi.Update,
-	commandHandlers map[string]func(b *Bot, update tgbotapi.Update) error,
+	commandHandlers map[string]HandlerFunc,
 	messageHandlers []func(b *Bot, update tgbotapi.Update) error,
-	callbackHandlers map[string]func(b *Bot, update tgbotapi.Update) error,
+	callbackHandlers map[string]HandlerFunc,
 ) {
+	b.mu.Lock()
+	handler := b.route(update, commandHandlers, messageHandlers, callbackHandlers)
+	middleware := b.middleware
+	b.mu.Unlock()
+	if handler == nil {
+		return
+	}
+
+	if err := Chain(handler, middleware...)(b, update); err != nil && !errors.Is(err, ErrMessageHandled) {
+		logger.Error(b.isAdmin(), fmt.Sprintf("[%s] %s handler error: %v", b.name, RouteName(update), err))
+	}
+}
+
+// route picks the handler for the update, nil when nothing should handle it. Called with b.mu held.
+func (b *Bot) route(
+	update tgbotapi.Update,
+	commandHandlers map[string]HandlerFunc,
+	messageHandlers []func(b *Bot, update tgbotapi.Update) error,
+	callbackHandlers map[string]HandlerFunc,
+) HandlerFunc {
+	// Handle inline queries
+	if update.InlineQuery != nil {
+		return b.inlineHandler
+	}
+
+	// Handle payments
+	if update.PreCheckoutQuery != nil {
+		return b.preCheckoutHandler
+	}
+	if update.Message != nil && update.Message.SuccessfulPayment != nil {
+		return b.paymentHandler
+	}
+
 	// Handle command updates
 	if update.Message != nil && update.Message.IsCommand() {
 		if handler, exists := commandHandlers[update.Message.Command()]; exists {
-			if err := handler(b, update); err != nil {
-				logger.Error(strings.Contains(b.name, "admin"), fmt.Sprintf("[%s] command handler error: %v", b.name, err))
-			}
-			return
+			return handler
 		}
 	}
 
 	// Handle callback queries
 	if update.CallbackQuery != nil {
-		parts := strings.SplitN(update.CallbackQuery.Data, ":", 3)
-		var query string
-		if len(parts) > 1 {
-			query = parts[0]
-		} else {
-			query = update.CallbackQuery.Data
+		if handler, exists := callbackHandlers[callbackPrefix(update.CallbackQuery.Data)]; exists {
+			return handler
 		}
-		if handler, exists := callbackHandlers[query]; exists {
-			if err := handler(b, update); err != nil {
-				logger.Error(strings.Contains(b.name, "admin"), fmt.Sprintf("[%s] callback handler error: %v", b.name, err))
-			}
-			return
-		} else {
-			b.SendMessage(update.Message.Chat.ID, "команда не распознана")
+		return func(b *Bot, update tgbotapi.Update) error {
+			return b.Reply(update, "команда не распознана")
 		}
 	}
 
 	// Run generic message handlers
-	for _, handler := range messageHandlers {
-		if err := handler(b, update); err != nil {
-			if errors.Is(err, ErrMessageHandled) {
-				break
+	return func(b *Bot, update tgbotapi.Update) error {
+		for _, handler := range messageHandlers {
+			if err := handler(b, update); err != nil {
+				if errors.Is(err, ErrMessageHandled) {
+					break
+				}
+				logger.Error(b.isAdmin(), fmt.Sprintf("[%s] message handler error: %v", b.name, err))
 			}
-			logger.Error(strings.Contains(b.name, "admin"), fmt.Sprintf("[%s] message handler error: %v", b.name, err))
 		}
+		return nil
 	}
 }
 
+// isAdmin tells whether the bot logs go to the admin log
+func (b *Bot) isAdmin() bool {
+	return strings.Contains(b.name, "Admin")
+}
+
 // Stop halts the bot
 func (b *Bot) Stop() {
 	b.mu.Lock()
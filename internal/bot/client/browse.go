@@ -0,0 +1,157 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+const (
+	browsePageSize  = 10
+	categoryTopSize = 10
+)
+
+// categorySongs returns the songs of a category that singers may choose, sorted by artist
+func categorySongs(category db.Category) []db.Song {
+	var songs []db.Song
+	for _, song := range db.Songbook.SongsInCategory(category.Name) {
+		if song.Excluded == 0 {
+			songs = append(songs, song)
+		}
+	}
+	return songs
+}
+
+func categoriesView() (string, tgbotapi.InlineKeyboardMarkup) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, category := range db.Categories {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(category.Name, fmt.Sprintf("browse_cat:%s:0", category.Key)),
+		))
+	}
+	return "выберите категорию:", tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func categoryView(category db.Category, page int) (string, tgbotapi.InlineKeyboardMarkup) {
+	songs := categorySongs(category)
+	pages := max(1, (len(songs)+browsePageSize-1)/browsePageSize)
+	page = max(0, min(page, pages-1))
+
+	start := page * browsePageSize
+	end := min(start+browsePageSize, len(songs))
+	rows := songRows(songs[start:end])
+
+	var navigation []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData("⬅️", fmt.Sprintf("browse_cat:%s:%d", category.Key, page-1)))
+	}
+	if page < pages-1 {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData("➡️", fmt.Sprintf("browse_cat:%s:%d", category.Key, page+1)))
+	}
+	if len(navigation) > 0 {
+		rows = append(rows, navigation)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔥 топ категории", "browse_top:"+category.Key),
+		tgbotapi.NewInlineKeyboardButtonData("↩️ категории", "browse"),
+	))
+
+	text := fmt.Sprintf("%s, песен: %d", category.Name, len(songs))
+	if pages > 1 {
+		text += fmt.Sprintf("\nстраница %d из %d", page+1, pages)
+	}
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func categoryTopView(category db.Category) (string, tgbotapi.InlineKeyboardMarkup) {
+	var songs []db.Song
+	for _, song := range categorySongs(category) {
+		if song.Counter > 0 {
+			songs = append(songs, song)
+		}
+	}
+	sort.SliceStable(songs, func(i, j int) bool { return songs[i].Counter > songs[j].Counter })
+	if len(songs) > categoryTopSize {
+		songs = songs[:categoryTopSize]
+	}
+
+	rows := songRows(songs)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📖 все песни категории", fmt.Sprintf("browse_cat:%s:0", category.Key)),
+		tgbotapi.NewInlineKeyboardButtonData("↩️ категории", "browse"),
+	))
+
+	text := fmt.Sprintf("🔥 чаще всего поют (%s):", category.Name)
+	if len(songs) == 0 {
+		text = fmt.Sprintf("в категории «%s» пока ничего не пели, будьте первыми!", category.Name)
+	}
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// songsHandler opens the category browser
+func (h *ClientHandlers) songsHandler(b *bot.Bot, update tgbotapi.Update) error {
+	if err := db.Users.Register(update); err != nil {
+		logger.Error(false, fmt.Sprintf("Error registering user\nChat ID: %d\nUsername: %s\nError: %v", update.Message.Chat.ID, update.Message.From.UserName, err))
+		return b.SendMessage(update.Message.Chat.ID, "произошла ошибка при регистрации")
+	}
+
+	logger.Info(false, fmt.Sprintf("User %s (%d) opened the category browser", update.Message.From.UserName, update.Message.Chat.ID))
+	text, keyboard := categoriesView()
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	msg.ReplyMarkup = keyboard
+	_, err := b.Client.Send(msg)
+	return err
+}
+
+// browseHandler moves through the category browser by editing its message
+func (h *ClientHandlers) browseHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	parts := strings.Split(query.Data, ":")
+
+	var text string
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	switch parts[0] {
+	case "browse":
+		text, keyboard = categoriesView()
+	case "browse_cat", "browse_top":
+		if len(parts) < 2 {
+			return b.SendMessage(chatID, "ошибка: неверный формат данных")
+		}
+		category, ok := db.CategoryByKey(parts[1])
+		if !ok {
+			return b.SendMessage(chatID, "такой категории больше нет")
+		}
+		if parts[0] == "browse_top" {
+			text, keyboard = categoryTopView(category)
+			break
+		}
+		page := 0
+		if len(parts) > 2 {
+			page, _ = strconv.Atoi(parts[2])
+		}
+		text, keyboard = categoryView(category, page)
+	default:
+		return b.SendMessage(chatID, "неизвестная команда")
+	}
+
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, text, keyboard)
+	_, err := b.Client.Send(editMsg)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
@@ -2,8 +2,10 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -12,40 +14,82 @@ import (
 	"github.com/sukalov/karaokebot/internal/db"
 	"github.com/sukalov/karaokebot/internal/logger"
 	"github.com/sukalov/karaokebot/internal/lyrics"
+	"github.com/sukalov/karaokebot/internal/payments"
 	"github.com/sukalov/karaokebot/internal/state"
 	"github.com/sukalov/karaokebot/internal/users"
+	"github.com/sukalov/karaokebot/internal/utils"
 )
 
-func paymentInfoLine(price int) string {
-	return fmt.Sprintf("сегодня караоке платное. спеть песню — %d рублей. можно перевести на тиньков сюда: https://www.tinkoff.ru/cf/9eX5F6qEily или по сбп на тиньков сюда: +7-916-06-506-11 матвей. не забудьте скриншот сделать", price)
+// paymentInfoLine tells singers how much a song costs tonight and where to send the money
+func paymentInfoLine(price int, methods []state.PaymentMethod) string {
+	if price == 0 {
+		return "сегодня караоке бесплатное, платить ничего не нужно 🎉"
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("сегодня караоке платное. спеть песню — %d %s.", price, utils.Plural(price, "рубль", "рубля", "рублей")))
+	if len(methods) == 0 {
+		builder.WriteString(" как оплатить, подскажет ведущий.")
+	} else {
+		builder.WriteString(" можно перевести:")
+		for _, method := range methods {
+			builder.WriteString(fmt.Sprintf("\n• %s: %s", method.Name, method.Details))
+		}
+	}
+	builder.WriteString("\n\nпосле оплаты пришлите сюда скриншот перевода")
+	return builder.String()
 }
 
-func lineJoinedMessage(typedName, songName, songLink string, price int) string {
-	if price > 0 {
-		return fmt.Sprintf("отлично, %s! вы выбрали песню \"%s\". скоро вас позовут на сцену\n\n%s\n\nа слова можно найти [здесь](%s)",
-			typedName, songName, paymentInfoLine(price), songLink)
+// paymentInfo renders paymentInfoLine with the current price and payment methods
+func (h *ClientHandlers) paymentInfo() string {
+	return paymentInfoLine(h.userManager.GetPrice(), h.userManager.GetPaymentMethods())
+}
+
+// lineJoinedMessage is sent with markdown, so the payment info is escaped
+func lineJoinedMessage(typedName, songName, songLink, paymentInfo string) string {
+	return fmt.Sprintf("отлично, %s! вы выбрали песню \"%s\". скоро вас позовут на сцену\n\n%s\n\nа слова можно найти [здесь](%s)\n\nхотите петь не один? позовите напарника через /me",
+		typedName, songName, tgbotapi.EscapeText(tgbotapi.ModeMarkdown, paymentInfo), songLink)
+}
+
+// limitMessage explains to the singer which limit stops them from signing up again
+func limitMessage(err *state.LimitError) string {
+	if err.Waiting {
+		songs := fmt.Sprintf("%d %s", err.Limit, utils.Plural(err.Limit, "песня", "песни", "песен"))
+		return fmt.Sprintf("в очереди одновременно может быть %s от одного человека. спойте то, на что уже записались, и возвращайтесь\n\nпесни вместе с кем-то тоже считаются", songs)
 	}
-	return fmt.Sprintf("отлично, %s! вы выбрали песню \"%s\". скоро вас позовут на сцену\n\nа слова можно найти [здесь](%s)",
-		typedName, songName, songLink)
+	// after "спеть" the word is in the accusative: "спеть 1 песню"
+	songs := fmt.Sprintf("%d %s", err.Limit, utils.Plural(err.Limit, "песню", "песни", "песен"))
+	return fmt.Sprintf("за вечер можно спеть %s, и вы уже записались на все\n\nпесни вместе с кем-то тоже считаются. УВЫ!", songs)
 }
 
 type ClientHandlers struct {
 	userManager   *state.StateManager
 	lyricsService *lyrics.Service
+	pendingSwap   map[int64]pendingSwap // chatID -> the entry waiting for a new song
+	searches      map[int64]string      // chatID -> last search query, for paging through the results
+	requests      map[int64]*songRequestDraft
+	pendingInvite map[int64]int // chatID -> ID of the entry waiting for a co-singer's @username
+	payments      PaymentInbox
+	invoices      *payments.Provider
+	mu            sync.Mutex
 }
 
-func NewClientHandlers(userManager *state.StateManager) *ClientHandlers {
+func NewClientHandlers(userManager *state.StateManager, paymentInbox PaymentInbox, invoices *payments.Provider) *ClientHandlers {
 	return &ClientHandlers{
 		userManager:   userManager,
+		payments:      paymentInbox,
+		invoices:      invoices,
 		lyricsService: lyrics.NewService(),
+		pendingSwap:   make(map[int64]pendingSwap),
+		searches:      make(map[int64]string),
+		requests:      make(map[int64]*songRequestDraft),
+		pendingInvite: make(map[int64]int),
 	}
 }
 
 func (h *ClientHandlers) startHandler(b *bot.Bot, update tgbotapi.Update) error {
 	message := update.Message
 	text := message.Text
-	userStates := h.userManager.GetAll()
-	ctx := context.Background()
 	err := db.Users.Register(update)
 
 	if err != nil {
@@ -57,109 +101,136 @@ func (h *ClientHandlers) startHandler(b *bot.Bot, update tgbotapi.Update) error
 		return b.SendMessage(update.Message.From.ID, "УВЫ! запись на караоке уже закрыта.\nподписываётесь на @povsemmestam чтобы не пропустить следующее")
 	}
 
-	// Extract song ID from /start command
+	// Extract song ID from /start command, a song picked on the site may be the one to swap to
+	if len(text) <= 7 || !strings.HasPrefix(text, "/start ") {
+		h.forgetPendingSwap(message.Chat.ID)
+	}
 	if len(text) > 7 && strings.HasPrefix(text, "/start ") {
 		songID := text[7:]
+		if strings.HasPrefix(songID, joinPrefix) {
+			return h.offerJoin(b, message.Chat.ID, songID)
+		}
 		song, found := db.Songbook.FindSongByID(songID)
 		if !found {
 			return b.SendMessage(message.Chat.ID, "извините, песни с таким id нет")
 		}
 
 		logger.Info(false, fmt.Sprintf("User %s (%d) started interaction with song %s", message.From.UserName, message.Chat.ID, songID))
+		return h.chooseSong(b, message.Chat.ID, message.From, song)
+	}
 
-		// Check if user exists in database
-		user, err := db.Users.GetByChatID(message.Chat.ID)
-		if err != nil {
-			logger.Error(false, fmt.Sprintf("Error fetching user\nChat ID: %d\nError: %v", message.Chat.ID, err))
-			return b.SendMessage(message.Chat.ID, "произошла ошибка при поиске пользователя")
-		}
+	return b.SendMessage(
+		message.Chat.ID,
+		"привет! напишите название песни или исполнителя, и я поищу в сонгбуке. все песни по категориям: /songs\n\nили выберите песню на сайте: https://karaoke.sukalov.dev",
+	)
+}
 
-		// Check if user has a saved name
-		var savedNameText string
-		if user.SavedName.Valid {
-			savedNameText = user.SavedName.String
-		}
+// chooseSong signs the user up for the song and asks who is going to sing it,
+// or swaps the song of an entry if the user asked for that
+func (h *ClientHandlers) chooseSong(b *bot.Bot, chatID int64, from *tgbotapi.User, song db.Song) error {
+	ctx := context.Background()
+	userStates := h.userManager.GetAll()
 
-		// Check existing states for this user
-		for _, state := range userStates {
-			if state.ChatID == message.Chat.ID && state.Stage == users.StageAskingName {
-				state.SongID = songID
-				state.SongName = db.Songbook.FormatSongName(song)
-				state.SongLink = song.Link
-				state.SongNote = song.AdditionalChords.String
-				state.LyricsURL = ""
-				state.LyricsText = ""
-				h.userManager.EditState(ctx, state.ID, state)
-				h.userManager.Sync(ctx)
-
-				// If user has a saved name, offer to use it
-				if savedNameText != "" {
-					return b.SendMessageWithButtons(
-						message.Chat.ID,
-						fmt.Sprintf("так-так. кто будет песть песню \"%s\"?\n\nнажмите на кнопку или напишите новое имя", state.SongName),
-						tgbotapi.NewInlineKeyboardMarkup(
-							tgbotapi.NewInlineKeyboardRow(
-								tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("записаться как %s", savedNameText), "use_saved_name"),
-							),
-						),
-					)
-				}
+	if swapID, swapping := h.takePendingSwap(chatID); swapping {
+		return h.swapSong(b, chatID, swapID, song)
+	}
 
-				return b.SendMessageWithMarkdown(
-					message.Chat.ID,
-					fmt.Sprintf("привет! *как тебя зовут?* \n\n (чтобы записаться и спеть песню \"%s\" осталось только написать имя певца/певцов)", state.SongName),
-					false,
-				)
-			}
-		}
+	// Check if user exists in database
+	user, err := db.Users.GetByChatID(chatID)
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Error fetching user\nChat ID: %d\nError: %v", chatID, err))
+		return b.SendMessage(chatID, "произошла ошибка при поиске пользователя")
+	}
 
-		// If no existing state, create a new one
-		previousStates := h.userManager.GetAllThisUser(message.Chat.ID)
-		limit := h.userManager.GetLimit()
-		if len(previousStates) >= limit {
-			return b.SendMessage(message.Chat.ID, "больше трёх раз записываться нельзя\n\nУВЫ!")
-		}
+	// Check if user has a saved name
+	var savedNameText string
+	if user.SavedName.Valid {
+		savedNameText = user.SavedName.String
+	}
 
-		// Prepare user state
-		userState := users.UserState{
-			ID:         len(userStates) + 1,
-			Username:   strings.ReplaceAll(message.From.UserName, "_", "\\_"),
-			TgName:     fmt.Sprintf("%s %s", message.From.FirstName, message.From.LastName),
-			SongID:     songID,
-			SongName:   db.Songbook.FormatSongName(song),
-			SongNote:   song.AdditionalChords.String,
-			SongLink:   song.Link,
-			ChatID:     message.Chat.ID,
-			Stage:      users.StageAskingName,
-			LyricsURL:  "",
-			LyricsText: "",
-		}
-		h.userManager.AddUser(ctx, userState)
-		h.userManager.Sync(ctx)
-
-		// If user has a saved name, offer to use it
-		if savedNameText != "" {
-			return b.SendMessageWithButtons(
-				message.Chat.ID,
-				fmt.Sprintf("так-так. кто будет песть песню \"%s\"?\n\nнажмите на кнопку или просто напишите новое имя", userState.SongName),
-				tgbotapi.NewInlineKeyboardMarkup(
-					tgbotapi.NewInlineKeyboardRow(
-						tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("записаться как %s", strings.ReplaceAll(savedNameText, "\\_", "_")), "use_saved_name"),
+	// Check existing states for this user
+	for _, state := range userStates {
+		if state.ChatID == chatID && state.Stage == users.StageAskingName {
+			updated, err := h.userManager.UpdateEntry(ctx, state.ID, users.StageAskingName, func(entry *users.UserState) error {
+				entry.SongID = song.ID
+				entry.SongName = db.Songbook.FormatSongName(song)
+				entry.SongLink = song.Link
+				entry.SongNote = song.AdditionalChords.String
+				entry.LyricsURL = ""
+				entry.LyricsText = ""
+				return nil
+			})
+			if err != nil {
+				logger.Error(false, fmt.Sprintf("Error changing song of user state\nState ID: %d\nChat ID: %d\nError: %v", state.ID, chatID, err))
+				continue
+			}
+			state = updated
+
+			// If user has a saved name, offer to use it
+			if savedNameText != "" {
+				return b.SendMessageWithButtons(
+					chatID,
+					fmt.Sprintf("так-так. кто будет песть песню \"%s\"?\n\nнажмите на кнопку или напишите новое имя", state.SongName),
+					tgbotapi.NewInlineKeyboardMarkup(
+						tgbotapi.NewInlineKeyboardRow(
+							tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("записаться как %s", savedNameText), fmt.Sprintf("use_saved_name:%d", state.ID)),
+						),
 					),
-				),
+				)
+			}
+
+			return b.SendMessageWithMarkdown(
+				chatID,
+				fmt.Sprintf("привет! *как тебя зовут?* \n\n (чтобы записаться и спеть песню \"%s\" осталось только написать имя певца/певцов)", state.SongName),
+				false,
 			)
 		}
+	}
+
+	// If no existing state, create a new one
+	stateID, err := h.userManager.NextID(ctx)
+	if err != nil {
+		return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+	}
 
-		return b.SendMessageWithMarkdown(
-			message.Chat.ID,
-			fmt.Sprintf("привет! *как тебя зовут?*\n\n(чтобы записаться и спеть песню \"%s\" осталось только написать имя певца/певцов)", userState.SongName),
-			false,
+	// Prepare user state
+	userState := users.UserState{
+		ID:         stateID,
+		Username:   strings.ReplaceAll(from.UserName, "_", "\\_"),
+		TgName:     fmt.Sprintf("%s %s", from.FirstName, from.LastName),
+		SongID:     song.ID,
+		SongName:   db.Songbook.FormatSongName(song),
+		SongNote:   song.AdditionalChords.String,
+		SongLink:   song.Link,
+		ChatID:     chatID,
+		Stage:      users.StageAskingName,
+		LyricsURL:  "",
+		LyricsText: "",
+	}
+	var limitErr *state.LimitError
+	if err := h.userManager.AddUserWithinLimits(ctx, userState); errors.As(err, &limitErr) {
+		return b.SendMessage(chatID, limitMessage(limitErr))
+	} else if err != nil {
+		return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+	}
+
+	// If user has a saved name, offer to use it
+	if savedNameText != "" {
+		return b.SendMessageWithButtons(
+			chatID,
+			fmt.Sprintf("так-так. кто будет песть песню \"%s\"?\n\nнажмите на кнопку или просто напишите новое имя", userState.SongName),
+			tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("записаться как %s", strings.ReplaceAll(savedNameText, "\\_", "_")), fmt.Sprintf("use_saved_name:%d", userState.ID)),
+				),
+			),
 		)
 	}
 
-	return b.SendMessage(
-		message.Chat.ID,
-		"не, просто так не работает. выбор песен в сонгбуке: https://karaoke.sukalov.dev",
+	return b.SendMessageWithMarkdown(
+		chatID,
+		fmt.Sprintf("привет! *как тебя зовут?*\n\n(чтобы записаться и спеть песню \"%s\" осталось только написать имя певца/певцов)", userState.SongName),
+		false,
 	)
 }
 
@@ -177,13 +248,20 @@ func (h *ClientHandlers) useSavedNameHandler(b *bot.Bot, update tgbotapi.Update)
 	defer cancel()
 
 	message := query.Message
-	userStates := h.userManager.GetAllThisUser(message.Chat.ID)
 
 	var stateToUpdate *users.UserState
-	for i, state := range userStates {
-		if state.Stage == users.StageAskingName {
-			stateToUpdate = &userStates[i]
-			break
+	if strings.Contains(query.Data, ":") {
+		if entry, ok := h.ownedEntry(query.Data, message.Chat.ID); ok && entry.Stage == users.StageAskingName {
+			stateToUpdate = &entry
+		}
+	} else {
+		// buttons sent before entry IDs were put into callback data
+		userStates := h.userManager.GetAllThisUser(message.Chat.ID)
+		for i, state := range userStates {
+			if state.Stage == users.StageAskingName {
+				stateToUpdate = &userStates[i]
+				break
+			}
 		}
 	}
 
@@ -212,19 +290,18 @@ func (h *ClientHandlers) useSavedNameHandler(b *bot.Bot, update tgbotapi.Update)
 		return fmt.Errorf("user saved name not found")
 	}
 
-	stateToUpdate.TypedName = user.SavedName.String
-
 	price := h.userManager.GetPrice()
-	stateToUpdate.Stage = users.StageInLine
-	stateToUpdate.TimeAdded = time.Now()
-
-	if err := h.userManager.EditState(ctx, stateToUpdate.ID, *stateToUpdate); err != nil {
+	updated, err := h.userManager.UpdateEntry(ctx, stateToUpdate.ID, users.StageAskingName, func(entry *users.UserState) error {
+		entry.TypedName = user.SavedName.String
+		entry.Stage = users.StageInLine
+		entry.TimeAdded = time.Now()
+		return nil
+	})
+	if err != nil {
 		logger.Error(false, fmt.Sprintf("Error editing user state\nState ID: %d\nChat ID: %d\nError: %v", stateToUpdate.ID, message.Chat.ID, err))
+		return b.SendMessage(message.Chat.ID, "жать на ту кнопку уже поздно")
 	}
-
-	if err := h.userManager.Sync(ctx); err != nil {
-		logger.Error(false, fmt.Sprintf("Error syncing user state\nChat ID: %d\nError: %v", message.Chat.ID, err))
-	}
+	*stateToUpdate = updated
 
 	if price > 0 {
 		if err := db.Users.IncrementTimesPerformed(stateToUpdate.ChatID); err != nil {
@@ -240,33 +317,42 @@ func (h *ClientHandlers) useSavedNameHandler(b *bot.Bot, update tgbotapi.Update)
 
 	logger.Info(false, fmt.Sprintf("User %s (%d) added to line with song %s", user.SavedName.String, message.Chat.ID, stateToUpdate.SongName))
 
-	// Fetch lyrics if it's an AmDm.ru URL
-	if strings.Contains(stateToUpdate.SongLink, "amdm.ru") {
-		go func() {
-			lyricsResult, err := h.lyricsService.ExtractLyrics(stateToUpdate.SongLink)
-			if err != nil {
-				logger.Error(false, fmt.Sprintf(" Failed to fetch lyrics for song %s (%s)\nURL: %s\nUser: %s (%d)\nError: %v",
-					stateToUpdate.SongID, stateToUpdate.SongName, stateToUpdate.SongLink, user.SavedName.String, message.Chat.ID, err))
-				return
-			}
-
-			if lyricsResult.Text != "" {
-				if err := b.SendMessageWithMarkdown(message.Chat.ID, lyricsResult.Text, false); err != nil {
-					logger.Error(false, fmt.Sprintf(" Failed to send lyrics to user %d for song %s\nError: %v",
-						message.Chat.ID, stateToUpdate.SongID, err))
-				}
-			} else {
-				logger.Error(false, fmt.Sprintf(" Lyrics result is empty for song %s (%s)\nURL: %s",
-					stateToUpdate.SongID, stateToUpdate.SongName, stateToUpdate.SongLink))
-			}
-		}()
-	}
+	h.sendLyrics(b, *stateToUpdate)
 
-	return b.SendMessageWithMarkdown(
+	if err := b.SendMessageWithMarkdown(
 		message.Chat.ID,
-		lineJoinedMessage(user.SavedName.String, stateToUpdate.SongName, stateToUpdate.SongLink, price),
+		lineJoinedMessage(user.SavedName.String, stateToUpdate.SongName, stateToUpdate.SongLink, h.paymentInfo()),
 		false,
-	)
+	); err != nil {
+		return err
+	}
+	h.sendInvoice(b, *stateToUpdate)
+	return nil
+}
+
+// sendLyrics fetches lyrics for AmDm.ru songs and sends them to the singer in the background
+func (h *ClientHandlers) sendLyrics(b *bot.Bot, entry users.UserState) {
+	if !strings.Contains(entry.SongLink, "amdm.ru") {
+		return
+	}
+	go func() {
+		lyricsResult, err := h.lyricsService.ExtractLyrics(entry.SongLink)
+		if err != nil {
+			logger.Error(false, fmt.Sprintf(" Failed to fetch lyrics for song %s (%s)\nURL: %s\nUser: %s (%d)\nError: %v",
+				entry.SongID, entry.SongName, entry.SongLink, entry.TypedName, entry.ChatID, err))
+			return
+		}
+
+		if lyricsResult.Text != "" {
+			if err := b.SendMessageWithMarkdown(entry.ChatID, lyricsResult.Text, false); err != nil {
+				logger.Error(false, fmt.Sprintf(" Failed to send lyrics to user %d for song %s\nError: %v",
+					entry.ChatID, entry.SongID, err))
+			}
+		} else {
+			logger.Error(false, fmt.Sprintf(" Lyrics result is empty for song %s (%s)\nURL: %s",
+				entry.SongID, entry.SongName, entry.SongLink))
+		}
+	}()
 }
 
 func (h *ClientHandlers) nameHandler(b *bot.Bot, update tgbotapi.Update) error {
@@ -296,15 +382,18 @@ func (h *ClientHandlers) nameHandler(b *bot.Bot, update tgbotapi.Update) error {
 	}
 
 	// Update the found state
-	stateToUpdate.TypedName = strings.ReplaceAll(message.Text, "_", "\\_")
-
-	price := h.userManager.GetPrice()
-	stateToUpdate.Stage = users.StageInLine
-	stateToUpdate.TimeAdded = time.Now()
-
 	ctx := context.Background()
-	h.userManager.EditState(ctx, stateToUpdate.ID, *stateToUpdate)
-	h.userManager.Sync(ctx)
+	updated, err := h.userManager.UpdateEntry(ctx, stateToUpdate.ID, users.StageAskingName, func(entry *users.UserState) error {
+		entry.TypedName = strings.ReplaceAll(message.Text, "_", "\\_")
+		entry.Stage = users.StageInLine
+		entry.TimeAdded = time.Now()
+		return nil
+	})
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Error editing user state\nState ID: %d\nChat ID: %d\nError: %v", stateToUpdate.ID, message.Chat.ID, err))
+		return b.SendMessage(message.Chat.ID, "эта запись уже изменилась, выберите песню ещё раз")
+	}
+	*stateToUpdate = updated
 	if err := db.Users.IncrementTimesPerformed(stateToUpdate.ChatID); err != nil {
 		logger.Error(false, fmt.Sprintf(" Failed to increment times performed\nChat ID: %d\nError: %v", stateToUpdate.ChatID, err))
 	}
@@ -317,49 +406,42 @@ func (h *ClientHandlers) nameHandler(b *bot.Bot, update tgbotapi.Update) error {
 
 	logger.Info(false, fmt.Sprintf("User %s (%d) added to line with song %s", stateToUpdate.TypedName, message.Chat.ID, stateToUpdate.SongName))
 
-	// Fetch lyrics if it's an AmDm.ru URL
-	if strings.Contains(stateToUpdate.SongLink, "amdm.ru") {
-		go func() {
-			lyricsResult, err := h.lyricsService.ExtractLyrics(stateToUpdate.SongLink)
-			if err != nil {
-				logger.Error(false, fmt.Sprintf(" Failed to fetch lyrics for song %s (%s)\nURL: %s\nUser: %s (%d)\nError: %v",
-					stateToUpdate.SongID, stateToUpdate.SongName, stateToUpdate.SongLink, stateToUpdate.TypedName, message.Chat.ID, err))
-				return
-			}
-
-			if lyricsResult.Text != "" {
-				if err := b.SendMessageWithMarkdown(message.Chat.ID, lyricsResult.Text, false); err != nil {
-					logger.Error(false, fmt.Sprintf(" Failed to send lyrics to user %d for song %s\nError: %v",
-						message.Chat.ID, stateToUpdate.SongID, err))
-				}
-			} else {
-				logger.Error(false, fmt.Sprintf(" Lyrics result is empty for song %s (%s)\nURL: %s",
-					stateToUpdate.SongID, stateToUpdate.SongName, stateToUpdate.SongLink))
-			}
-		}()
-	}
+	h.sendLyrics(b, *stateToUpdate)
 
-	return b.SendMessageWithMarkdown(
+	if err := b.SendMessageWithMarkdown(
 		message.Chat.ID,
-		lineJoinedMessage(stateToUpdate.TypedName, stateToUpdate.SongName, stateToUpdate.SongLink, price),
+		lineJoinedMessage(stateToUpdate.TypedName, stateToUpdate.SongName, stateToUpdate.SongLink, h.paymentInfo()),
 		false,
-	)
+	); err != nil {
+		return err
+	}
+	h.sendInvoice(b, *stateToUpdate)
+	return nil
 }
 
 func randomMessageHandler(b *bot.Bot, update tgbotapi.Update) error {
 	return b.SendMessage(
 		update.Message.Chat.ID,
-		"этого я не понимаю...\n\nвыбор песен в сонгбуке: https://karaoke.sukalov.dev",
+		"этого я не понимаю... напишите текстом название песни или исполнителя\n\nвыбор песен в сонгбуке: https://karaoke.sukalov.dev",
 	)
 }
 
-func SetupHandlers(clientBot *bot.Bot, userManager *state.StateManager) {
-	handlers := NewClientHandlers(userManager)
+func SetupHandlers(clientBot *bot.Bot, userManager *state.StateManager, paymentInbox PaymentInbox, invoices *payments.Provider) {
+	handlers := NewClientHandlers(userManager, paymentInbox, invoices)
 	messageHandlers := []func(b *bot.Bot, update tgbotapi.Update) error{
 		func(b *bot.Bot, update tgbotapi.Update) error {
 			if update.Message == nil {
 				return nil
 			}
+			if handled, err := handlers.handlePaymentPhoto(b, update); handled {
+				return err
+			}
+			if handled, err := handlers.handleSongRequestInput(b, update); handled {
+				return err
+			}
+			if handled, err := handlers.handleDuetInviteInput(b, update); handled {
+				return err
+			}
 			// Handle name input for song selection
 			userStates := userManager.GetAll()
 			for _, state := range userStates {
@@ -368,16 +450,39 @@ func SetupHandlers(clientBot *bot.Bot, userManager *state.StateManager) {
 				}
 			}
 
-			return randomMessageHandler(b, update)
+			return handlers.searchHandler(b, update)
 		},
 	}
 
 	// Pass userManager to GetCommandHandlers
 	commandHandlers := common.GetCommandHandlers(userManager)
 	commandHandlers["start"] = handlers.startHandler
+	commandHandlers["me"] = handlers.meHandler
+	commandHandlers["songs"] = handlers.songsHandler
+	commandHandlers["request"] = handlers.requestHandler
 
 	callbackHandlers := common.GetCallbackHandlers(userManager)
 	callbackHandlers["use_saved_name"] = handlers.useSavedNameHandler
+	callbackHandlers["withdraw"] = handlers.withdrawHandler
+	callbackHandlers["swap"] = handlers.swapHandler
+	callbackHandlers["swap_cancel"] = handlers.swapCancelHandler
+	callbackHandlers["search_page"] = handlers.searchPageHandler
+	callbackHandlers["pick_song"] = handlers.pickSongHandler
+	callbackHandlers["browse"] = handlers.browseHandler
+	callbackHandlers["browse_cat"] = handlers.browseHandler
+	callbackHandlers["browse_top"] = handlers.browseHandler
+	callbackHandlers["pay_invoice"] = handlers.payInvoiceHandler
+	callbackHandlers["duet_invite"] = handlers.duetInviteHandler
+	callbackHandlers["duet_accept"] = handlers.duetAnswerHandler
+	callbackHandlers["duet_decline"] = handlers.duetAnswerHandler
+	callbackHandlers["request_song"] = handlers.requestCallbackHandler
+	callbackHandlers["request_cancel"] = handlers.requestCallbackHandler
+	callbackHandlers["request_skip_link"] = handlers.requestCallbackHandler
+
+	clientBot.SetInlineHandler(handlers.inlineQueryHandler)
+	if invoices.Enabled() {
+		clientBot.SetPaymentHandlers(handlers.preCheckoutHandler, handlers.successfulPaymentHandler)
+	}
 
 	go clientBot.Start(
 		commandHandlers,
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/state"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// joinPrefix marks /start parameters that join someone else's entry: join_<entry ID>_<invite code>
+const joinPrefix = "join_"
+
+func newInviteCode() string {
+	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	code := make([]byte, 8)
+	for i := range code {
+		code[i] = charset[rand.Intn(len(charset))]
+	}
+	return string(code)
+}
+
+func inviteLink(botUsername string, entry users.UserState) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%d_%s", botUsername, joinPrefix, entry.ID, entry.InviteCode)
+}
+
+func plainName(name string) string {
+	return strings.ReplaceAll(name, "\\_", "_")
+}
+
+// invitedEntry finds the entry an invitation points to, as long as it can still be joined
+func (h *ClientHandlers) invitedEntry(stateID int, code string) (users.UserState, bool) {
+	entry, found := h.userManager.Get(stateID)
+	if !found || entry.Stage != users.StageInLine || entry.InviteCode == "" || entry.InviteCode != code {
+		return users.UserState{}, false
+	}
+	return entry, true
+}
+
+func joinKeyboard(entry users.UserState) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎤 пою!", fmt.Sprintf("duet_accept:%d:%s", entry.ID, entry.InviteCode)),
+			tgbotapi.NewInlineKeyboardButtonData("не в этот раз", fmt.Sprintf("duet_decline:%d:%s", entry.ID, entry.InviteCode)),
+		),
+	)
+}
+
+func joinOffer(entry users.UserState) string {
+	return fmt.Sprintf("%s зовёт вас спеть вместе «%s». записаться с ними?", plainName(entry.TypedName), entry.SongName)
+}
+
+// duetInviteHandler gives the singer a link to share with co-singers and waits for an @username
+func (h *ClientHandlers) duetInviteHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	entry, ok := h.ownedEntry(query.Data, chatID)
+	if !ok || entry.Stage != users.StageInLine {
+		return b.SendMessage(chatID, "в эту запись уже нельзя никого позвать")
+	}
+
+	if entry.InviteCode == "" {
+		var err error
+		entry, err = h.userManager.UpdateEntry(context.Background(), entry.ID, users.StageInLine, func(entry *users.UserState) error {
+			if entry.InviteCode == "" {
+				entry.InviteCode = newInviteCode()
+			}
+			return nil
+		})
+		if errors.Is(err, state.ErrStageChanged) {
+			return b.SendMessage(chatID, "в эту запись уже нельзя никого позвать")
+		}
+		if err != nil {
+			logger.Error(false, fmt.Sprintf("Error saving invite code\nState ID: %d\nChat ID: %d\nError: %v", entry.ID, chatID, err))
+			return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+		}
+	}
+
+	h.mu.Lock()
+	h.pendingInvite[chatID] = entry.ID
+	h.mu.Unlock()
+
+	return b.SendMessage(chatID, fmt.Sprintf("чтобы спеть «%s» вместе, перешлите напарнику эту ссылку:\n%s\n\nили пришлите сюда его @username, если он уже писал этому боту", entry.SongName, inviteLink(b.Client.Self.UserName, entry)))
+}
+
+// handleDuetInviteInput sends an invitation to the @username the singer typed after asking to invite someone.
+// It reports false when the message is not an invitation, so it can be handled as usual.
+func (h *ClientHandlers) handleDuetInviteInput(b *bot.Bot, update tgbotapi.Update) (bool, error) {
+	chatID := update.Message.Chat.ID
+
+	h.mu.Lock()
+	stateID, ok := h.pendingInvite[chatID]
+	delete(h.pendingInvite, chatID)
+	h.mu.Unlock()
+
+	text := strings.TrimSpace(update.Message.Text)
+	if !ok || !strings.HasPrefix(text, "@") || strings.ContainsAny(text, " \n") {
+		return false, nil
+	}
+
+	entry, found := h.userManager.Get(stateID)
+	if !found || entry.ChatID != chatID || entry.Stage != users.StageInLine {
+		return true, b.SendMessage(chatID, "в эту запись уже нельзя никого позвать")
+	}
+
+	invitee, err := db.Users.GetByUsername(text)
+	if errors.Is(err, db.ErrUserNotFound) {
+		return true, b.SendMessage(chatID, fmt.Sprintf("%s ещё не писал(а) этому боту. перешлите ему ссылку:\n%s", text, inviteLink(b.Client.Self.UserName, entry)))
+	}
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Error looking up invitee\nUsername: %s\nError: %v", text, err))
+		return true, b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+	}
+	if entry.HasSinger(invitee.ChatID) {
+		return true, b.SendMessage(chatID, fmt.Sprintf("%s уже поёт эту песню", text))
+	}
+
+	msg := tgbotapi.NewMessage(invitee.ChatID, joinOffer(entry))
+	msg.ReplyMarkup = joinKeyboard(entry)
+	if _, err := b.Client.Send(msg); err != nil {
+		logger.Error(false, fmt.Sprintf("Error sending invitation\nChat ID: %d\nError: %v", invitee.ChatID, err))
+		return true, b.SendMessage(chatID, fmt.Sprintf("не получилось написать %s, перешлите ему ссылку:\n%s", text, inviteLink(b.Client.Self.UserName, entry)))
+	}
+
+	logger.Info(false, fmt.Sprintf("User %d invited %s to sing %s", chatID, text, entry.SongName))
+	return true, b.SendMessage(chatID, fmt.Sprintf("приглашение отправлено, %s осталось его принять", text))
+}
+
+// offerJoin asks someone who opened an invitation link to confirm
+func (h *ClientHandlers) offerJoin(b *bot.Bot, chatID int64, param string) error {
+	idText, code, _ := strings.Cut(strings.TrimPrefix(param, joinPrefix), "_")
+	stateID, err := strconv.Atoi(idText)
+	if err != nil {
+		return b.SendMessage(chatID, "это приглашение не работает")
+	}
+	entry, ok := h.invitedEntry(stateID, code)
+	if !ok {
+		return b.SendMessage(chatID, "это приглашение уже не действует: песню спели или запись отменили")
+	}
+	if entry.HasSinger(chatID) {
+		return b.SendMessage(chatID, "вы уже поёте эту песню, всё в порядке")
+	}
+
+	msg := tgbotapi.NewMessage(chatID, joinOffer(entry))
+	msg.ReplyMarkup = joinKeyboard(entry)
+	_, err = b.Client.Send(msg)
+	return err
+}
+
+func (h *ClientHandlers) duetAnswerHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	parts := strings.SplitN(query.Data, ":", 3)
+	if len(parts) != 3 {
+		return b.SendMessage(chatID, "ошибка: неверный формат данных")
+	}
+	stateID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return b.SendMessage(chatID, "ошибка: неверный формат данных")
+	}
+	entry, ok := h.invitedEntry(stateID, parts[2])
+	if !ok {
+		return b.SendMessage(chatID, "это приглашение уже не действует: песню спели или запись отменили")
+	}
+
+	name := strings.TrimSpace(query.From.FirstName + " " + query.From.LastName)
+	if user, err := db.Users.GetByChatID(chatID); err == nil && user.SavedName.Valid {
+		name = plainName(user.SavedName.String)
+	}
+
+	if parts[0] == "duet_decline" {
+		if err := b.SendMessage(entry.ChatID, fmt.Sprintf("%s не сможет спеть с вами «%s»", name, entry.SongName)); err != nil {
+			logger.Error(false, fmt.Sprintf("Error telling about declined invitation\nChat ID: %d\nError: %v", entry.ChatID, err))
+		}
+		return b.SendMessage(chatID, "ок, в другой раз!")
+	}
+
+	if !h.userManager.IsOpen() {
+		return b.SendMessage(chatID, "УВЫ! запись на караоке уже закрыта.\nподписываётесь на @povsemmestam чтобы не пропустить следующее")
+	}
+	participant := users.Participant{
+		ChatID:   chatID,
+		Username: query.From.UserName,
+		Name:     strings.ReplaceAll(name, "_", "\\_"),
+	}
+	entry, err = h.userManager.AddParticipant(context.Background(), entry.ID, participant)
+	if errors.Is(err, state.ErrAlreadySinging) {
+		return b.SendMessage(chatID, "вы уже поёте эту песню, всё в порядке")
+	}
+	var limitErr *state.LimitError
+	if errors.As(err, &limitErr) {
+		return b.SendMessage(chatID, limitMessage(limitErr))
+	}
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Error adding participant\nState ID: %d\nChat ID: %d\nError: %v", stateID, chatID, err))
+		return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+	}
+
+	if err := db.Users.IncrementTimesPerformed(chatID); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to increment times performed\nChat ID: %d\nError: %v", chatID, err))
+	}
+
+	logger.Info(false, fmt.Sprintf("User %s (%d) joined %s singing %s", name, chatID, entry.TypedName, entry.SongName))
+	if err := b.SendMessage(entry.ChatID, fmt.Sprintf("%s поёт с вами «%s» 🎉", name, entry.SongName)); err != nil {
+		logger.Error(false, fmt.Sprintf("Error telling about accepted invitation\nChat ID: %d\nError: %v", entry.ChatID, err))
+	}
+
+	text := fmt.Sprintf("отлично! вы поёте «%s» вместе (%s). мы напишем, когда подойдёт очередь", entry.SongName, plainName(entry.TypedName))
+	text += "\n\n" + h.paymentInfo()
+	h.sendLyrics(b, users.UserState{ChatID: chatID, SongID: entry.SongID, SongName: entry.SongName, SongLink: entry.SongLink, TypedName: participant.Name})
+	return b.SendMessage(chatID, text)
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+const (
+	// inlineResultsLimit keeps the answer small, telegram allows up to 50 results
+	inlineResultsLimit = 20
+	// inlineCacheSeconds is how long telegram may reuse an answer for the same query
+	inlineCacheSeconds = 60
+)
+
+// signupLink is a deep link that opens the client bot and starts the signup for the song
+func signupLink(botUsername, songID string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", botUsername, songID)
+}
+
+// inlineQueryHandler answers "@bot <song or artist>" from any chat with matching songs,
+// an empty query shows the most popular ones
+func (h *ClientHandlers) inlineQueryHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.InlineQuery
+	text := strings.TrimSpace(query.Query)
+
+	var songs []db.Song
+	if text == "" {
+		for _, song := range db.Songbook.TopSongs(inlineResultsLimit) {
+			if song.Excluded == 0 {
+				songs = append(songs, song)
+			}
+		}
+	} else {
+		songs = searchableSongs(text)
+	}
+	if len(songs) > inlineResultsLimit {
+		songs = songs[:inlineResultsLimit]
+	}
+
+	results := make([]interface{}, 0, len(songs))
+	for _, song := range songs {
+		songName := db.Songbook.FormatSongName(song)
+		link := signupLink(b.Client.Self.UserName, song.ID)
+
+		article := tgbotapi.NewInlineQueryResultArticle(song.ID, songName, fmt.Sprintf("🎤 %s\n\nзаписаться на эту песню: %s", songName, link))
+		article.Description = song.Category
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonURL("записаться", link),
+			),
+		)
+		article.ReplyMarkup = &keyboard
+		results = append(results, article)
+	}
+
+	if text != "" {
+		logger.Info(false, fmt.Sprintf("User %s (%d) looked up %q inline, found %d songs", query.From.UserName, query.From.ID, text, len(results)))
+	}
+
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     inlineCacheSeconds,
+	}
+	_, err := b.Client.Request(answer)
+	return err
+}
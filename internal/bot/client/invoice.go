@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/payments"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// canPayByCard reports whether the singer can pay for the entry with a telegram invoice
+func (h *ClientHandlers) canPayByCard(entry users.UserState) bool {
+	return h.invoices.Enabled() && h.userManager.GetPrice() > 0 && entry.ChatID != 0 &&
+		entry.Payment != users.PaymentPaid && !entry.IsFinished()
+}
+
+// sendInvoice sends a telegram invoice for the entry when payment by card is possible
+func (h *ClientHandlers) sendInvoice(b *bot.Bot, entry users.UserState) {
+	if !h.canPayByCard(entry) {
+		return
+	}
+	if _, err := b.Client.Send(h.invoices.Invoice(entry, h.userManager.GetPrice())); err != nil {
+		logger.Error(false, fmt.Sprintf("Error sending invoice\nState ID: %d\nChat ID: %d\nError: %v", entry.ID, entry.ChatID, err))
+	}
+}
+
+func (h *ClientHandlers) payInvoiceHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	entry, ok := h.ownedEntry(query.Data, chatID)
+	if !ok || !h.canPayByCard(entry) {
+		return b.SendMessage(chatID, "эту запись уже не нужно оплачивать")
+	}
+	h.sendInvoice(b, entry)
+	return nil
+}
+
+// checkoutErrorMessage explains to the payer why telegram did not take the payment
+func checkoutErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, payments.ErrAlreadyPaid):
+		return "эта песня уже оплачена"
+	case errors.Is(err, payments.ErrEntryGone):
+		return "этой записи уже нет в очереди"
+	case errors.Is(err, payments.ErrWrongPayer):
+		return "оплатить песню может только тот, кто на неё записался"
+	}
+	return "этот счёт устарел, запросите новый в /me"
+}
+
+// preCheckoutHandler lets telegram take the payment only while the entry still needs it
+func (h *ClientHandlers) preCheckoutHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.PreCheckoutQuery
+
+	order, err := payments.ParsePayload(query.InvoicePayload)
+	if err == nil {
+		entry, found := h.userManager.Get(order.EntryID)
+		err = payments.Check(order, entry, found, query.From.ID, query.Currency, query.TotalAmount)
+	}
+
+	// tgbotapi.PreCheckoutConfig leaves out ok=false, which telegram requires, so the params are built by hand
+	params := tgbotapi.Params{
+		"pre_checkout_query_id": query.ID,
+		"ok":                    strconv.FormatBool(err == nil),
+	}
+	if err != nil {
+		params.AddNonEmpty("error_message", checkoutErrorMessage(err))
+		logger.Info(false, fmt.Sprintf("Declined checkout\nPayload: %s\nChat ID: %d\nReason: %v", query.InvoicePayload, query.From.ID, err))
+	}
+	_, requestErr := b.Client.MakeRequest("answerPreCheckoutQuery", params)
+	return requestErr
+}
+
+// successfulPaymentHandler marks the entry as paid once telegram has taken the money
+func (h *ClientHandlers) successfulPaymentHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	payment := message.SuccessfulPayment
+	chatID := message.Chat.ID
+
+	order, err := payments.ParsePayload(payment.InvoicePayload)
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Payment with unknown payload\nPayload: %s\nChat ID: %d\nCharge ID: %s", payment.InvoicePayload, chatID, payment.TelegramPaymentChargeID))
+		return b.SendMessage(chatID, "оплата прошла, но я не понял, за что она. покажите это сообщение ведущему")
+	}
+
+	updated, _, err := h.userManager.SetPayment(context.Background(), []int{order.EntryID}, users.PaymentPaid)
+	if err != nil || len(updated) == 0 {
+		logger.Error(false, fmt.Sprintf("Error marking entry paid\nState ID: %d\nChat ID: %d\nCharge ID: %s\nError: %v", order.EntryID, chatID, payment.TelegramPaymentChargeID, err))
+		return b.SendMessage(chatID, "оплата прошла, но отметить запись не получилось. покажите это сообщение ведущему")
+	}
+
+	logger.Info(true, fmt.Sprintf("User %s (%d) paid %d.%02d %s for %s\nCharge ID: %s\nProvider charge ID: %s",
+		message.From.UserName, chatID, payment.TotalAmount/100, payment.TotalAmount%100, payment.Currency, updated[0].SongName,
+		payment.TelegramPaymentChargeID, payment.ProviderPaymentChargeID))
+	return b.SendMessage(chatID, fmt.Sprintf("оплата прошла, спасибо! «%s» оплачена ✅", updated[0].SongName))
+}
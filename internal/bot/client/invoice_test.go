@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/payments"
+	"github.com/sukalov/karaokebot/internal/state"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+const (
+	singerChatID = int64(100)
+	songPrice    = 500
+)
+
+// stubAPI is a Bot API server that records the calls the bot makes
+type stubAPI struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	calls  []stubCall
+}
+
+type stubCall struct {
+	method string
+	params map[string]string
+}
+
+func newStubAPI(t *testing.T) *stubAPI {
+	stub := &stubAPI{}
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch method {
+		case "getMe":
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"karaoke","username":"karaoke_test_bot"}}`))
+			return
+		case "getUpdates":
+			// keep the bot from polling in a busy loop
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("bad request to %s: %v", method, err)
+		}
+		params := make(map[string]string, len(r.Form))
+		for key := range r.Form {
+			params[key] = r.Form.Get(key)
+		}
+		stub.mu.Lock()
+		stub.calls = append(stub.calls, stubCall{method: method, params: params})
+		stub.mu.Unlock()
+
+		if method == "answerPreCheckoutQuery" {
+			w.Write([]byte(`{"ok":true,"result":true}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":100,"type":"private"}}}`))
+	}))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+// take returns the calls made so far and forgets them
+func (s *stubAPI) take() []stubCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := s.calls
+	s.calls = nil
+	return calls
+}
+
+func newTestHandlers(t *testing.T, entries ...users.UserState) (*ClientHandlers, *bot.Bot, *stubAPI) {
+	t.Helper()
+	ctx := context.Background()
+
+	store, err := state.NewMemoryStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userManager := state.NewStateManager(store)
+	if err := userManager.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := userManager.SetPrice(ctx, songPrice); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := userManager.AddUser(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stub := newStubAPI(t)
+	clientBot, err := bot.NewWithEndpoint("ClientBot", "test-token", stub.server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(clientBot.Client.StopReceivingUpdates)
+
+	return NewClientHandlers(userManager, nil, payments.New("test-provider-token")), clientBot, stub
+}
+
+func TestPreCheckoutHandler(t *testing.T) {
+	waiting := users.UserState{ID: 1, ChatID: singerChatID, SongName: "группа крови", Stage: users.StageInLine}
+	paid := users.UserState{ID: 2, ChatID: singerChatID, SongName: "кукушка", Stage: users.StageInLine, Payment: users.PaymentPaid}
+	performed := users.UserState{ID: 3, ChatID: singerChatID, SongName: "звезда", Stage: users.StagePerformed}
+	amount := payments.Amount(songPrice)
+
+	tests := []struct {
+		name      string
+		payload   string
+		payerID   int64
+		currency  string
+		total     int
+		wantOK    string
+		wantError string
+	}{
+		{name: "accepted", payload: "entry:1:50000", payerID: singerChatID, currency: payments.Currency, total: amount, wantOK: "true"},
+		{name: "already paid", payload: "entry:2:50000", payerID: singerChatID, currency: payments.Currency, total: amount, wantOK: "false", wantError: "эта песня уже оплачена"},
+		{name: "entry performed", payload: "entry:3:50000", payerID: singerChatID, currency: payments.Currency, total: amount, wantOK: "false", wantError: "этой записи уже нет в очереди"},
+		{name: "entry gone", payload: "entry:9:50000", payerID: singerChatID, currency: payments.Currency, total: amount, wantOK: "false", wantError: "этой записи уже нет в очереди"},
+		{name: "someone else", payload: "entry:1:50000", payerID: 300, currency: payments.Currency, total: amount, wantOK: "false", wantError: "оплатить песню может только тот, кто на неё записался"},
+		{name: "total differs from invoice", payload: "entry:1:50000", payerID: singerChatID, currency: payments.Currency, total: 30000, wantOK: "false", wantError: "этот счёт устарел, запросите новый в /me"},
+		{name: "foreign payload", payload: "donation", payerID: singerChatID, currency: payments.Currency, total: amount, wantOK: "false", wantError: "этот счёт устарел, запросите новый в /me"},
+	}
+
+	h, clientBot, stub := newTestHandlers(t, waiting, paid, performed)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := tgbotapi.Update{PreCheckoutQuery: &tgbotapi.PreCheckoutQuery{
+				ID:             "query-" + tt.name,
+				From:           &tgbotapi.User{ID: tt.payerID},
+				Currency:       tt.currency,
+				TotalAmount:    tt.total,
+				InvoicePayload: tt.payload,
+			}}
+			if err := h.preCheckoutHandler(clientBot, update); err != nil {
+				t.Fatalf("preCheckoutHandler() error = %v", err)
+			}
+
+			calls := stub.take()
+			if len(calls) != 1 || calls[0].method != "answerPreCheckoutQuery" {
+				t.Fatalf("calls = %+v, want one answerPreCheckoutQuery", calls)
+			}
+			params := calls[0].params
+			if params["pre_checkout_query_id"] != "query-"+tt.name {
+				t.Errorf("pre_checkout_query_id = %q", params["pre_checkout_query_id"])
+			}
+			if params["ok"] != tt.wantOK {
+				t.Errorf("ok = %q, want %q", params["ok"], tt.wantOK)
+			}
+			if params["error_message"] != tt.wantError {
+				t.Errorf("error_message = %q, want %q", params["error_message"], tt.wantError)
+			}
+		})
+	}
+}
+
+func TestSuccessfulPaymentHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantPayment string
+		wantText    string
+	}{
+		{name: "entry marked paid", payload: "entry:1:50000", wantPayment: users.PaymentPaid, wantText: "оплата прошла, спасибо! «группа крови» оплачена ✅"},
+		{name: "unknown payload", payload: "donation", wantPayment: users.PaymentPending, wantText: "оплата прошла, но я не понял, за что она. покажите это сообщение ведущему"},
+		{name: "entry gone", payload: "entry:9:50000", wantPayment: users.PaymentPending, wantText: "оплата прошла, но отметить запись не получилось. покажите это сообщение ведущему"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := users.UserState{ID: 1, ChatID: singerChatID, SongName: "группа крови", Stage: users.StageInLine, Payment: users.PaymentPending}
+			h, clientBot, stub := newTestHandlers(t, entry)
+
+			update := tgbotapi.Update{Message: &tgbotapi.Message{
+				Chat: &tgbotapi.Chat{ID: singerChatID},
+				From: &tgbotapi.User{ID: singerChatID, UserName: "singer"},
+				SuccessfulPayment: &tgbotapi.SuccessfulPayment{
+					Currency:                payments.Currency,
+					TotalAmount:             payments.Amount(songPrice),
+					InvoicePayload:          tt.payload,
+					TelegramPaymentChargeID: "tg-charge",
+					ProviderPaymentChargeID: "provider-charge",
+				},
+			}}
+			if err := h.successfulPaymentHandler(clientBot, update); err != nil {
+				t.Fatalf("successfulPaymentHandler() error = %v", err)
+			}
+
+			calls := stub.take()
+			if len(calls) != 1 || calls[0].method != "sendMessage" {
+				t.Fatalf("calls = %+v, want one sendMessage", calls)
+			}
+			if got := calls[0].params["text"]; got != tt.wantText {
+				t.Errorf("text = %q, want %q", got, tt.wantText)
+			}
+			if got, _ := h.userManager.Get(1); got.Payment != tt.wantPayment {
+				t.Errorf("payment = %q, want %q", got.Payment, tt.wantPayment)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/state"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+func formatWait(wait time.Duration) string {
+	minutes := int(wait.Round(time.Minute).Minutes())
+	if minutes < 1 {
+		return "вот-вот"
+	}
+	if minutes < 60 {
+		return fmt.Sprintf("примерно через %d мин", minutes)
+	}
+	return fmt.Sprintf("примерно через %d ч %d мин", minutes/60, minutes%60)
+}
+
+func (h *ClientHandlers) entryStatus(entry users.UserState) string {
+	switch entry.Stage {
+	case users.StageAskingName:
+		return "ждём имя певца, чтобы записать"
+	case users.StageInLine:
+		if h.userManager.IsHeld(entry) {
+			return "встанете в очередь, как только админы подтвердят оплату"
+		}
+		position, ok := h.userManager.Position(entry.ID)
+		if !ok {
+			return "в очереди"
+		}
+		return fmt.Sprintf("%d-й в очереди, %s", position, formatWait(h.userManager.EstimateWait(position)))
+	case users.StagePerforming:
+		return "🎤 сейчас на сцене!"
+	case users.StagePerformed:
+		return "уже спели ✅"
+	case users.StageSkipped, users.StageNoShow:
+		return "пропущено"
+	}
+	return entry.Stage
+}
+
+func (h *ClientHandlers) meHandler(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	entries := h.userManager.GetAllThisUser(chatID)
+	h.forgetPendingSwap(chatID)
+
+	logger.Info(false, fmt.Sprintf("User %s (%d) checked their place in line", update.Message.From.UserName, chatID))
+
+	if len(entries) == 0 {
+		return b.SendMessage(chatID, "вы пока никуда не записаны\n\nвыбор песен в сонгбуке: https://karaoke.sukalov.dev")
+	}
+
+	var builder strings.Builder
+	var rows [][]tgbotapi.InlineKeyboardButton
+	builder.WriteString("ваши записи:\n\n")
+	for _, entry := range entries {
+		name := entry.TypedName
+		if name == "" {
+			name = "без имени"
+		}
+		builder.WriteString(fmt.Sprintf("«%s» (%s)\n%s\n", entry.SongName, name, h.entryStatus(entry)))
+		if payment := h.paymentStatus(entry); payment != "" && entry.ChatID == chatID && entry.Stage != users.StageAskingName {
+			builder.WriteString(payment + "\n")
+		}
+		builder.WriteString("\n")
+
+		// co-singers see the entry, but only the one who signed up can change it
+		if entry.Stage == users.StageInLine && entry.ChatID == chatID {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("❌ отменить «%s»", entry.SongName), fmt.Sprintf("withdraw:%d", entry.ID)),
+			), tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🔁 сменить «%s»", entry.SongName), fmt.Sprintf("swap:%d", entry.ID)),
+			), tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("👯 позвать напарника в «%s»", entry.SongName), fmt.Sprintf("duet_invite:%d", entry.ID)),
+			))
+		}
+		if entry.ChatID == chatID && entry.Stage != users.StageAskingName && h.canPayByCard(entry) {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💳 оплатить «%s» картой", entry.SongName), fmt.Sprintf("pay_invoice:%d", entry.ID)),
+			))
+		}
+	}
+
+	text := strings.TrimSpace(builder.String())
+	if len(rows) == 0 {
+		return b.SendMessageWithMarkdown(chatID, text, true)
+	}
+	return b.SendMessageWithButtons(chatID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// ownedEntry parses the entry ID from callback data and makes sure the entry belongs to the chat
+func (h *ClientHandlers) ownedEntry(data string, chatID int64) (users.UserState, bool) {
+	parts := strings.SplitN(data, ":", 2)
+	if len(parts) != 2 {
+		return users.UserState{}, false
+	}
+	stateID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return users.UserState{}, false
+	}
+	entry, found := h.userManager.Get(stateID)
+	if !found || entry.ChatID != chatID {
+		return users.UserState{}, false
+	}
+	return entry, true
+}
+
+func (h *ClientHandlers) withdrawHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	entry, ok := h.ownedEntry(query.Data, chatID)
+	if !ok || entry.Stage != users.StageInLine {
+		return b.SendMessage(chatID, "эту запись уже нельзя отменить")
+	}
+
+	ctx := context.Background()
+	if err := h.userManager.RemoveState(ctx, entry.ID); err != nil {
+		logger.Error(false, fmt.Sprintf("Error withdrawing entry\nState ID: %d\nChat ID: %d\nError: %v", entry.ID, chatID, err))
+		return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+	}
+
+	h.forgetPendingSwap(chatID)
+
+	logger.Info(false, fmt.Sprintf("User %s (%d) withdrew from line with song %s", entry.TypedName, chatID, entry.SongName))
+	return b.SendMessage(chatID, fmt.Sprintf("запись на песню \"%s\" отменена", entry.SongName))
+}
+
+func (h *ClientHandlers) swapHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	entry, ok := h.ownedEntry(query.Data, chatID)
+	if !ok || entry.Stage != users.StageInLine {
+		return b.SendMessage(chatID, "в этой записи уже нельзя сменить песню")
+	}
+
+	h.mu.Lock()
+	h.pendingSwap[chatID] = pendingSwap{stateID: entry.ID, askedAt: time.Now()}
+	h.mu.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("напишите название новой песни вместо \"%s\" или выберите её в сонгбуке: https://karaoke.sukalov.dev\n\nместо в очереди сохранится", entry.SongName))
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("не менять", "swap_cancel"),
+		),
+	)
+	_, err := b.Client.Send(msg)
+	return err
+}
+
+func (h *ClientHandlers) swapCancelHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	if _, ok := h.takePendingSwap(chatID); !ok {
+		return b.SendMessage(chatID, "песню и так никто не меняет")
+	}
+	return b.SendMessage(chatID, "хорошо, песня остаётся прежней")
+}
+
+// swapTimeout is how long a request to change the song waits for the new one
+const swapTimeout = 10 * time.Minute
+
+// pendingSwap is an entry the user asked to change the song for
+type pendingSwap struct {
+	stateID int
+	askedAt time.Time
+}
+
+// takePendingSwap returns and forgets the entry the user wants to change the song for,
+// a request older than swapTimeout is dropped so a later song pick signs up as usual
+func (h *ClientHandlers) takePendingSwap(chatID int64) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	swap, ok := h.pendingSwap[chatID]
+	delete(h.pendingSwap, chatID)
+	if !ok || time.Since(swap.askedAt) > swapTimeout {
+		return 0, false
+	}
+	return swap.stateID, true
+}
+
+// forgetPendingSwap drops the request to change the song, if any
+func (h *ClientHandlers) forgetPendingSwap(chatID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.pendingSwap, chatID)
+}
+
+// swapSong replaces the song of a queued entry, keeping its place in line
+func (h *ClientHandlers) swapSong(b *bot.Bot, chatID int64, stateID int, song db.Song) error {
+	entry, found := h.userManager.Get(stateID)
+	if !found || entry.ChatID != chatID || entry.Stage != users.StageInLine {
+		return b.SendMessage(chatID, "эта запись уже не в очереди, песню сменить нельзя")
+	}
+
+	oldSongName := entry.SongName
+	ctx := context.Background()
+	entry, err := h.userManager.UpdateEntry(ctx, entry.ID, users.StageInLine, func(entry *users.UserState) error {
+		entry.SongID = song.ID
+		entry.SongName = db.Songbook.FormatSongName(song)
+		entry.SongLink = song.Link
+		entry.SongNote = song.AdditionalChords.String
+		entry.LyricsURL = ""
+		entry.LyricsText = ""
+		return nil
+	})
+	if errors.Is(err, state.ErrStageChanged) {
+		return b.SendMessage(chatID, "эта запись уже не в очереди, песню сменить нельзя")
+	}
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Error swapping song\nState ID: %d\nChat ID: %d\nError: %v", stateID, chatID, err))
+		return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+	}
+	if err := db.Songbook.IncrementSongCounter(entry.SongID); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to increment song counter\nSong ID: %s\nChat ID: %d\nError: %v", entry.SongID, chatID, err))
+	}
+
+	logger.Info(false, fmt.Sprintf("User %s (%d) swapped song %s for %s", entry.TypedName, chatID, oldSongName, entry.SongName))
+	h.sendLyrics(b, entry)
+
+	return b.SendMessageWithMarkdown(
+		chatID,
+		fmt.Sprintf("готово! вместо \"%s\" вы поёте \"%s\", место в очереди то же\n\nслова можно найти [здесь](%s)", oldSongName, entry.SongName, entry.SongLink),
+		false,
+	)
+}
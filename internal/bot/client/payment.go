@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// PaymentInbox passes payment screenshots on to the admins
+type PaymentInbox interface {
+	// SubmitPayment shows the screenshot to admins, asking them to confirm payment for the entries
+	SubmitPayment(entries []users.UserState, photo []byte) error
+}
+
+// paymentResubmitAfter is how long a screenshot waits for the admins before the singer may send it again,
+// in case the admin message got lost or nobody looked at it
+const paymentResubmitAfter = 15 * time.Minute
+
+// unpaidEntries returns the entries of the chat that still need a payment screenshot, entries whose
+// screenshot the admins have not checked for too long need one again
+func (h *ClientHandlers) unpaidEntries(chatID int64) (unpaid []users.UserState, pending int) {
+	for _, entry := range h.userManager.GetAllThisUser(chatID) {
+		if entry.ChatID != chatID || entry.IsFinished() || entry.Stage == users.StageAskingName {
+			continue
+		}
+		switch entry.Payment {
+		case users.PaymentUnpaid, users.PaymentRejected:
+			unpaid = append(unpaid, entry)
+		case users.PaymentPending:
+			if time.Since(entry.PaymentSentAt) >= paymentResubmitAfter {
+				unpaid = append(unpaid, entry)
+			} else {
+				pending++
+			}
+		}
+	}
+	return unpaid, pending
+}
+
+// downloadPhoto fetches the largest size of the photo, file IDs only work for the bot that received them
+func downloadPhoto(b *bot.Bot, photo []tgbotapi.PhotoSize) ([]byte, error) {
+	link, err := b.Client.GetFileDirectURL(photo[len(photo)-1].FileID)
+	if err != nil {
+		return nil, err
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(link)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// handlePaymentPhoto sends a payment screenshot to the admins and marks the singer's entries as waiting
+// for confirmation. It reports false when the message has no photo.
+func (h *ClientHandlers) handlePaymentPhoto(b *bot.Bot, update tgbotapi.Update) (bool, error) {
+	message := update.Message
+	if len(message.Photo) == 0 {
+		return false, nil
+	}
+	chatID := message.Chat.ID
+
+	if h.userManager.GetPrice() == 0 {
+		return true, b.SendMessage(chatID, "сегодня караоке бесплатное, платить не нужно 🎉")
+	}
+
+	unpaid, pending := h.unpaidEntries(chatID)
+	if len(unpaid) == 0 {
+		if pending > 0 {
+			return true, b.SendMessage(chatID, fmt.Sprintf("ваш скриншот уже у админов, напишу, как только они его проверят. если за %d минут ответа не будет, пришлите скриншот ещё раз", int(paymentResubmitAfter.Minutes())))
+		}
+		return true, b.SendMessage(chatID, "не нашёл записей, которые нужно оплатить. сначала выберите песню, а потом пришлите скриншот")
+	}
+
+	photo, err := downloadPhoto(b, message.Photo)
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Error downloading payment screenshot\nChat ID: %d\nError: %v", chatID, err))
+		return true, b.SendMessage(chatID, "не получилось загрузить скриншот, пришлите его ещё раз")
+	}
+
+	// entries are marked first, an admin may press a button as soon as the screenshot arrives
+	ids := make([]int, 0, len(unpaid))
+	for _, entry := range unpaid {
+		ids = append(ids, entry.ID)
+	}
+	ctx := context.Background()
+	marked, _, err := h.userManager.SetPayment(ctx, ids, users.PaymentPending)
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Error marking payment pending\nChat ID: %d\nError: %v", chatID, err))
+		h.restorePayment(ctx, unpaid)
+		return true, b.SendMessage(chatID, "произошла ошибка, пришлите скриншот ещё раз")
+	}
+	if len(marked) == 0 {
+		return true, b.SendMessage(chatID, "не нашёл записей, которые нужно оплатить. сначала выберите песню, а потом пришлите скриншот")
+	}
+
+	if err := h.payments.SubmitPayment(marked, photo); err != nil {
+		logger.Error(false, fmt.Sprintf("Error sending payment screenshot to admins\nChat ID: %d\nError: %v", chatID, err))
+		h.restorePayment(ctx, unpaid)
+		return true, b.SendMessage(chatID, "не получилось отправить скриншот админам, пришлите его ещё раз или покажите ведущему")
+	}
+
+	logger.Info(false, fmt.Sprintf("User %s (%d) sent a payment screenshot for %d songs", message.From.UserName, chatID, len(unpaid)))
+	return true, b.SendMessage(chatID, "спасибо! скриншот отправлен админам, напишу, как только они его проверят")
+}
+
+// restorePayment puts back the payment statuses the entries had before. Pending entries are only sent
+// again once their screenshot went stale, they become unpaid so the singer can retry right away.
+func (h *ClientHandlers) restorePayment(ctx context.Context, entries []users.UserState) {
+	byStatus := make(map[string][]int)
+	for _, entry := range entries {
+		status := entry.Payment
+		if status == users.PaymentPending {
+			status = users.PaymentUnpaid
+		}
+		byStatus[status] = append(byStatus[status], entry.ID)
+	}
+	for status, ids := range byStatus {
+		if _, _, err := h.userManager.SetPayment(ctx, ids, status); err != nil {
+			logger.Error(false, fmt.Sprintf("Error restoring payment status\nEntries: %v\nError: %v", ids, err))
+		}
+	}
+}
+
+// paymentStatus tells the singer where their payment is, empty when there is nothing to say
+func (h *ClientHandlers) paymentStatus(entry users.UserState) string {
+	if h.userManager.GetPrice() == 0 || entry.ChatID == 0 {
+		return ""
+	}
+	switch entry.Payment {
+	case users.PaymentPaid:
+		return "оплачено ✅"
+	case users.PaymentPending:
+		return "оплата на проверке ⏳"
+	case users.PaymentRejected:
+		return "оплату не нашли, пришлите скриншот ещё раз"
+	}
+	return "не оплачено, пришлите сюда скриншот перевода"
+}
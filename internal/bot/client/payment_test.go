@@ -0,0 +1,74 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+func TestUnpaidEntries(t *testing.T) {
+	entry := func(id int, payment string, sentAgo time.Duration) users.UserState {
+		state := users.UserState{ID: id, ChatID: singerChatID, TypedName: "анна", SongName: "Кукушка", Stage: users.StageInLine, Payment: payment}
+		if sentAgo > 0 {
+			state.PaymentSentAt = time.Now().Add(-sentAgo)
+		}
+		return state
+	}
+
+	tests := []struct {
+		name        string
+		entries     []users.UserState
+		wantUnpaid  []int
+		wantPending int
+	}{
+		{
+			name:       "unpaid and rejected entries need a screenshot",
+			entries:    []users.UserState{entry(1, users.PaymentUnpaid, 0), entry(2, users.PaymentRejected, 0)},
+			wantUnpaid: []int{1, 2},
+		},
+		{
+			name:    "paid entries are done",
+			entries: []users.UserState{entry(1, users.PaymentPaid, time.Hour)},
+		},
+		{
+			name:        "a fresh screenshot waits for the admins",
+			entries:     []users.UserState{entry(1, users.PaymentPending, time.Minute), entry(2, users.PaymentUnpaid, 0)},
+			wantUnpaid:  []int{2},
+			wantPending: 1,
+		},
+		{
+			name:       "a stale screenshot may be sent again",
+			entries:    []users.UserState{entry(1, users.PaymentPending, paymentResubmitAfter+time.Minute)},
+			wantUnpaid: []int{1},
+		},
+		{
+			name: "finished entries and other singers are skipped",
+			entries: []users.UserState{
+				withStage(entry(1, users.PaymentUnpaid, 0), users.StagePerformed),
+				withStage(entry(2, users.PaymentUnpaid, 0), users.StageAskingName),
+				{ID: 3, ChatID: singerChatID + 1, Stage: users.StageInLine},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, _ := newTestHandlers(t, tt.entries...)
+			unpaid, pending := h.unpaidEntries(singerChatID)
+			var ids []int
+			for _, entry := range unpaid {
+				ids = append(ids, entry.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantUnpaid) || pending != tt.wantPending {
+				t.Errorf("unpaidEntries() = %v, %d, want %v, %d", ids, pending, tt.wantUnpaid, tt.wantPending)
+			}
+		})
+	}
+}
+
+func withStage(entry users.UserState, stage string) users.UserState {
+	entry.Stage = stage
+	return entry
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+// songRequestDraft collects a song request one message at a time
+type songRequestDraft struct {
+	artist string
+	title  string
+}
+
+func requestCancelKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ отмена", "request_cancel"),
+		),
+	)
+}
+
+func (h *ClientHandlers) sendRequestStep(b *bot.Bot, chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	_, err := b.Client.Send(msg)
+	return err
+}
+
+func (h *ClientHandlers) startSongRequest(b *bot.Bot, chatID int64) error {
+	h.mu.Lock()
+	h.requests[chatID] = &songRequestDraft{}
+	h.mu.Unlock()
+	return h.sendRequestStep(b, chatID, "какой песни не хватает в сонгбуке? напишите, кто её исполняет", requestCancelKeyboard())
+}
+
+func (h *ClientHandlers) requestHandler(b *bot.Bot, update tgbotapi.Update) error {
+	return h.startSongRequest(b, update.Message.Chat.ID)
+}
+
+func (h *ClientHandlers) requestCallbackHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	switch query.Data {
+	case "request_song":
+		return h.startSongRequest(b, chatID)
+	case "request_cancel":
+		h.mu.Lock()
+		delete(h.requests, chatID)
+		h.mu.Unlock()
+		return b.SendMessage(chatID, "ок, заявку не отправляем")
+	case "request_skip_link":
+		h.mu.Lock()
+		draft, ok := h.requests[chatID]
+		delete(h.requests, chatID)
+		h.mu.Unlock()
+		if !ok || draft.title == "" {
+			return b.SendMessage(chatID, "жать на ту кнопку уже поздно")
+		}
+		return h.submitSongRequest(b, chatID, query.From.UserName, *draft, "")
+	}
+	return b.SendMessage(chatID, "неизвестная команда")
+}
+
+// handleSongRequestInput takes the next answer of a song request, it reports false if the user
+// is not filling one in
+func (h *ClientHandlers) handleSongRequestInput(b *bot.Bot, update tgbotapi.Update) (bool, error) {
+	chatID := update.Message.Chat.ID
+
+	h.mu.Lock()
+	draft, ok := h.requests[chatID]
+	h.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	text := strings.TrimSpace(update.Message.Text)
+	if text == "" || update.Message.IsCommand() {
+		return true, b.SendMessage(chatID, "нужно написать текстом")
+	}
+
+	h.mu.Lock()
+	switch {
+	case draft.artist == "":
+		draft.artist = text
+		h.mu.Unlock()
+		return true, h.sendRequestStep(b, chatID, "как называется песня?", requestCancelKeyboard())
+	case draft.title == "":
+		draft.title = text
+		h.mu.Unlock()
+		return true, h.sendRequestStep(b, chatID,
+			"если знаете, где найти аккорды (например, на amdm.ru), пришлите ссылку. это сильно ускорит дело",
+			tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData("ссылки нет", "request_skip_link"),
+					tgbotapi.NewInlineKeyboardButtonData("❌ отмена", "request_cancel"),
+				),
+			),
+		)
+	}
+	delete(h.requests, chatID)
+	submitted := *draft
+	h.mu.Unlock()
+	return true, h.submitSongRequest(b, chatID, update.Message.From.UserName, submitted, text)
+}
+
+func (h *ClientHandlers) submitSongRequest(b *bot.Bot, chatID int64, username string, draft songRequestDraft, link string) error {
+	request := db.SongRequest{
+		ChatID:   chatID,
+		Username: sql.NullString{String: username, Valid: username != ""},
+		Artist:   draft.artist,
+		Title:    draft.title,
+		Link:     sql.NullString{String: link, Valid: link != ""},
+	}
+	id, err := db.SongRequests.Create(request)
+	if err != nil {
+		logger.Error(false, fmt.Sprintf("Error saving song request\nChat ID: %d\nError: %v", chatID, err))
+		return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+	}
+
+	logger.Info(true, fmt.Sprintf("New song request #%d from %s (%d): %s — %s\nсмотреть заявки: /requests", id, username, chatID, draft.artist, draft.title))
+	return b.SendMessage(chatID, fmt.Sprintf("спасибо! заявка на песню «%s — %s» отправлена. напишем, когда админы её рассмотрят", draft.artist, draft.title))
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/bot"
+	"github.com/sukalov/karaokebot/internal/db"
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+const searchPageSize = 8
+
+// searchableSongs finds songs for singers, songs excluded from the songbook site are hidden here too
+func searchableSongs(query string) []db.Song {
+	var songs []db.Song
+	for _, song := range db.Songbook.SearchSongs(query) {
+		if song.Excluded == 0 {
+			songs = append(songs, song)
+		}
+	}
+	return songs
+}
+
+// songRows makes a button per song, pressing one starts the signup
+func songRows(songs []db.Song) [][]tgbotapi.InlineKeyboardButton {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(songs))
+	for _, song := range songs {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(db.Songbook.FormatSongName(song), "pick_song:"+song.ID),
+		))
+	}
+	return rows
+}
+
+// searchPage renders one page of results with a button per song and arrows to other pages
+func searchPage(query string, results []db.Song, page int) (string, tgbotapi.InlineKeyboardMarkup) {
+	pages := (len(results) + searchPageSize - 1) / searchPageSize
+	page = max(0, min(page, pages-1))
+
+	start := page * searchPageSize
+	end := min(start+searchPageSize, len(results))
+	rows := songRows(results[start:end])
+
+	var navigation []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData("⬅️", fmt.Sprintf("search_page:%d", page-1)))
+	}
+	if page < pages-1 {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData("➡️", fmt.Sprintf("search_page:%d", page+1)))
+	}
+	if len(navigation) > 0 {
+		rows = append(rows, navigation)
+	}
+
+	text := fmt.Sprintf("по запросу «%s» найдено песен: %d\nвыберите, какую будете петь:", query, len(results))
+	if pages > 1 {
+		text += fmt.Sprintf("\n\nстраница %d из %d", page+1, pages)
+	}
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (h *ClientHandlers) searchHandler(b *bot.Bot, update tgbotapi.Update) error {
+	message := update.Message
+	text := strings.TrimSpace(message.Text)
+	if text == "" || message.IsCommand() {
+		return randomMessageHandler(b, update)
+	}
+
+	if err := db.Users.Register(update); err != nil {
+		logger.Error(false, fmt.Sprintf("Error registering user\nChat ID: %d\nUsername: %s\nError: %v", message.Chat.ID, message.From.UserName, err))
+		return b.SendMessage(message.Chat.ID, "произошла ошибка при регистрации")
+	}
+
+	if !h.userManager.IsOpen() {
+		return b.SendMessage(message.Chat.ID, "УВЫ! запись на караоке уже закрыта.\nподписываётесь на @povsemmestam чтобы не пропустить следующее")
+	}
+
+	results := searchableSongs(text)
+	logger.Info(false, fmt.Sprintf("User %s (%d) searched for %q, found %d songs", message.From.UserName, message.Chat.ID, text, len(results)))
+	if len(results) == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("по запросу «%s» ничего не нашлось. попробуйте написать иначе или выберите песню в сонгбуке: https://karaoke.sukalov.dev\n\nесли песни правда нет, можно попросить её добавить", text))
+		msg.DisableWebPagePreview = true
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🙋 попросить добавить песню", "request_song"),
+			),
+		)
+		_, err := b.Client.Send(msg)
+		return err
+	}
+
+	h.mu.Lock()
+	h.searches[message.Chat.ID] = text
+	h.mu.Unlock()
+
+	pageText, keyboard := searchPage(text, results, 0)
+	msg := tgbotapi.NewMessage(message.Chat.ID, pageText)
+	msg.ReplyMarkup = keyboard
+	_, err := b.Client.Send(msg)
+	return err
+}
+
+func (h *ClientHandlers) searchPageHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	page, err := strconv.Atoi(strings.TrimPrefix(query.Data, "search_page:"))
+	if err != nil {
+		return b.SendMessage(chatID, "ошибка: неверный формат данных")
+	}
+
+	h.mu.Lock()
+	text, ok := h.searches[chatID]
+	h.mu.Unlock()
+	results := searchableSongs(text)
+	if !ok || len(results) == 0 {
+		return b.SendMessage(chatID, "этот поиск устарел, напишите название песни ещё раз")
+	}
+
+	pageText, keyboard := searchPage(text, results, page)
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, pageText, keyboard)
+	_, err = b.Client.Send(editMsg)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+func (h *ClientHandlers) pickSongHandler(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Client.Request(callback); err != nil {
+		logger.Error(false, fmt.Sprintf(" Failed to answer callback query\nQuery ID: %s\nError: %v", query.ID, err))
+		return err
+	}
+
+	chatID := query.Message.Chat.ID
+	if !h.userManager.IsOpen() {
+		return b.SendMessage(chatID, "УВЫ! запись на караоке уже закрыта.\nподписываётесь на @povsemmestam чтобы не пропустить следующее")
+	}
+
+	songID := strings.TrimPrefix(query.Data, "pick_song:")
+	song, found := db.Songbook.FindSongByID(songID)
+	if !found || song.Excluded != 0 {
+		return b.SendMessage(chatID, "извините, этой песни больше нет в сонгбуке")
+	}
+
+	logger.Info(false, fmt.Sprintf("User %s (%d) picked song %s", query.From.UserName, chatID, songID))
+	return h.chooseSong(b, chatID, query.From, song)
+}
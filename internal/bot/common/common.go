@@ -3,12 +3,12 @@ package common
 import (
 	"encoding/json"
 	"fmt"
-	"sort"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sukalov/karaokebot/internal/bot"
 	"github.com/sukalov/karaokebot/internal/logger"
 	"github.com/sukalov/karaokebot/internal/state"
+	"github.com/sukalov/karaokebot/internal/users"
 	"github.com/sukalov/karaokebot/internal/utils"
 )
 
@@ -45,20 +45,57 @@ func newCommonHandlers(userManager *state.StateManager) *CommonHandlers {
 	}
 }
 
+// FormatSong renders the song of an entry as a markdown link when it has one
+func FormatSong(entry users.UserState) string {
+	if entry.SongLink == "" {
+		return entry.SongName
+	}
+	return fmt.Sprintf("[%s](%s)", entry.SongName, entry.SongLink)
+}
+
+// paymentLabel shows admins where the payment of an entry is, empty on free nights and for walk-ins
+func paymentLabel(entry users.UserState, price int) string {
+	if price == 0 || entry.ChatID == 0 {
+		return ""
+	}
+	switch entry.Payment {
+	case users.PaymentPaid:
+		return "✅ оплачено"
+	case users.PaymentPending:
+		return "⏳ оплата на проверке"
+	case users.PaymentRejected:
+		return "❌ оплата не найдена"
+	}
+	return "💸 не оплачено"
+}
+
 func (h *CommonHandlers) lineHandler(b *bot.Bot, update tgbotapi.Update) error {
 	message := update.Message
-	lineUsers := h.userManager.GetAllInLine()
+	current, performing := h.userManager.GetCurrent()
+	lineUsers := h.userManager.GetQueue()
+	held := h.userManager.GetHeld()
+	price := h.userManager.GetPrice()
 
-	if len(lineUsers) == 0 {
+	if len(lineUsers) == 0 && len(held) == 0 && !performing {
 		logger.Info(false, fmt.Sprintf(" /line command executed - queue is empty"))
 		return b.SendMessage(message.Chat.ID, "в очереди никого нет")
 	}
 
 	logger.Info(false, fmt.Sprintf(" /line command executed - %d users in queue", len(lineUsers)))
 
-	sort.Sort(state.ByTimeAdded(lineUsers))
-
 	lineMessage := ""
+	if performing {
+		lineMessage += fmt.Sprintf(
+			"🎤 *сейчас поёт: %s*\n   песня: %s\n   на сцене с: %s\n\n",
+			current.TypedName,
+			FormatSong(current),
+			utils.ConvertToMoscowTime(current.TimeCalled),
+		)
+	}
+	if len(lineUsers) == 0 {
+		lineMessage += "больше в очереди никого нет"
+	}
+
 	i := 0
 	for idx, userState := range lineUsers {
 		var note string
@@ -67,14 +104,20 @@ func (h *CommonHandlers) lineHandler(b *bot.Bot, update tgbotapi.Update) error {
 		} else {
 			note = fmt.Sprintf("   заметка по песне: %s\n", userState.SongNote)
 		}
+		contact := fmt.Sprintf("юзернейм: @%s", userState.Username)
+		if userState.ChatID == 0 {
+			contact = "записан админом (без телеграма)"
+		}
+		if payment := paymentLabel(userState, price); payment != "" {
+			contact += "\n   " + payment
+		}
 		lineMessage += fmt.Sprintf(
-			"%d. %s\n   песня: [%s](%s)\n   добавлен: %s\n   юзернейм: @%s\n%s\n",
+			"%d. %s\n   песня: %s\n   добавлен: %s\n   %s\n%s\n",
 			idx+1,
 			userState.TypedName,
-			userState.SongName,
-			userState.SongLink,
+			FormatSong(userState),
 			utils.ConvertToMoscowTime(userState.TimeAdded),
-			userState.Username,
+			contact,
 			note,
 		)
 		i += 1
@@ -85,6 +128,16 @@ func (h *CommonHandlers) lineHandler(b *bot.Bot, update tgbotapi.Update) error {
 		}
 	}
 
+	if len(held) > 0 {
+		lineMessage += "\n*ждут подтверждения оплаты, в очередь пока не попали:*\n"
+		for _, userState := range held {
+			lineMessage += fmt.Sprintf("• %s — %s (@%s), %s\n", userState.TypedName, FormatSong(userState), userState.Username, paymentLabel(userState, price))
+		}
+	}
+
+	if lineMessage == "" {
+		return nil
+	}
 	return b.SendMessageWithMarkdown(message.Chat.ID, lineMessage, true)
 }
 
@@ -0,0 +1,324 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+// HandlerFunc handles a single update
+type HandlerFunc func(b *Bot, update tgbotapi.Update) error
+
+// Middleware wraps a handler with behaviour shared by many routes, such as checks or logging.
+// It may call next, or answer the update itself and stop.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain wraps handler with middleware, the first one runs first
+func Chain(handler HandlerFunc, middleware ...Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Route attaches middleware to commands and callback prefixes passed to Start
+type Route struct {
+	Commands   []string
+	Callbacks  []string
+	Middleware []Middleware
+}
+
+// Sender returns the user who sent the update, nil when there is none
+func Sender(update tgbotapi.Update) *tgbotapi.User {
+	switch {
+	case update.Message != nil:
+		return update.Message.From
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From
+	case update.InlineQuery != nil:
+		return update.InlineQuery.From
+	case update.PreCheckoutQuery != nil:
+		return update.PreCheckoutQuery.From
+	}
+	return nil
+}
+
+// RouteName names the handler an update goes to, like "/start" or "callback:edit_song"
+func RouteName(update tgbotapi.Update) string {
+	switch {
+	case update.InlineQuery != nil:
+		return "inline"
+	case update.PreCheckoutQuery != nil:
+		return "pre_checkout"
+	case update.Message != nil && update.Message.SuccessfulPayment != nil:
+		return "payment"
+	case update.Message != nil && update.Message.IsCommand():
+		return "/" + update.Message.Command()
+	case update.CallbackQuery != nil:
+		return "callback:" + callbackPrefix(update.CallbackQuery.Data)
+	}
+	return "message"
+}
+
+// knownRoute is RouteName with the commands and callbacks the bot has no handler for
+// folded into "/unknown" and "callback:unknown", so whatever users type does not add routes
+func (b *Bot) knownRoute(update tgbotapi.Update) string {
+	route := RouteName(update)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if name, ok := strings.CutPrefix(route, "/"); ok {
+		if _, exists := b.commands[name]; !exists {
+			return "/unknown"
+		}
+	}
+	if name, ok := strings.CutPrefix(route, "callback:"); ok {
+		if _, exists := b.callbacks[name]; !exists {
+			return "callback:unknown"
+		}
+	}
+	return route
+}
+
+// Reply tells the sender something: a toast for callback queries, a message otherwise
+func (b *Bot) Reply(update tgbotapi.Update, text string) error {
+	if query := update.CallbackQuery; query != nil {
+		_, err := b.Client.Request(tgbotapi.NewCallbackWithAlert(query.ID, text))
+		return err
+	}
+	if update.Message != nil {
+		return b.SendMessage(update.Message.Chat.ID, text)
+	}
+	return nil
+}
+
+// maxLoggedStack keeps a panic stack within a single log channel message
+const maxLoggedStack = 3000
+
+// Recover turns a panic in a handler into an error, so one broken update does not take the bot down
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(b *Bot, update tgbotapi.Update) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					stack := string(debug.Stack())
+					if len(stack) > maxLoggedStack {
+						stack = stack[:maxLoggedStack] + "\n..."
+					}
+					logger.Error(b.isAdmin(), fmt.Sprintf("[%s] panic in %s: %v\n%s", b.name, RouteName(update), r, stack))
+					err = fmt.Errorf("panic in %s: %v", RouteName(update), r)
+					b.Reply(update, "что-то сломалось, попробуйте ещё раз")
+				}
+			}()
+			return next(b, update)
+		}
+	}
+}
+
+// Logging writes every handled update with its sender and duration to the debug log
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(b *Bot, update tgbotapi.Update) error {
+			start := time.Now()
+			err := next(b, update)
+
+			sender := "unknown"
+			if user := Sender(update); user != nil {
+				sender = fmt.Sprintf("%d", user.ID)
+				if user.UserName != "" {
+					sender = fmt.Sprintf("@%s (%d)", user.UserName, user.ID)
+				}
+			}
+			// failures are logged as errors by the bot itself, this is only the trace
+			if err != nil && !errors.Is(err, ErrMessageHandled) {
+				logger.Debug(b.isAdmin(), fmt.Sprintf("[%s] %s from %s failed in %s: %v", b.name, RouteName(update), sender, time.Since(start), err))
+			} else {
+				logger.Debug(b.isAdmin(), fmt.Sprintf("[%s] %s from %s in %s", b.name, RouteName(update), sender, time.Since(start)))
+			}
+			return err
+		}
+	}
+}
+
+// RateLimit lets each user send burst updates at once and one more every interval after that.
+// Inline queries and payments pass through, the first arrive on every keystroke and the
+// second must always be answered.
+func RateLimit(burst int, interval time.Duration) Middleware {
+	limiter := newRateLimiter(burst, interval, time.Now)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(b *Bot, update tgbotapi.Update) error {
+			user := Sender(update)
+			if user == nil || update.InlineQuery != nil || update.PreCheckoutQuery != nil ||
+				(update.Message != nil && update.Message.SuccessfulPayment != nil) {
+				return next(b, update)
+			}
+			ok, warn := limiter.allow(user.ID)
+			if ok {
+				return next(b, update)
+			}
+			if warn {
+				return b.Reply(update, "слишком много сообщений, подождите немного")
+			}
+			return nil
+		}
+	}
+}
+
+// rateLimiter keeps a token bucket per user
+type rateLimiter struct {
+	burst    int
+	interval time.Duration
+	// idle is how long a bucket takes to fill up again, dropping it then is the same as starting over
+	idle      time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   map[int64]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	warned bool
+}
+
+func newRateLimiter(burst int, interval time.Duration, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		burst:     burst,
+		interval:  interval,
+		idle:      time.Duration(burst) * interval,
+		now:       now,
+		buckets:   make(map[int64]*bucket),
+		lastSweep: now(),
+	}
+}
+
+// allow takes a token from the user's bucket, warn is set on the first update refused in a row
+func (l *rateLimiter) allow(userID int64) (ok, warn bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > l.idle {
+		for id, bk := range l.buckets {
+			if now.Sub(bk.last) > l.idle {
+				delete(l.buckets, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bk, exists := l.buckets[userID]
+	if !exists {
+		bk = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[userID] = bk
+	}
+	bk.tokens += float64(now.Sub(bk.last)) / float64(l.interval)
+	if bk.tokens > float64(l.burst) {
+		bk.tokens = float64(l.burst)
+	}
+	bk.last = now
+
+	if bk.tokens < 1 {
+		warn = !bk.warned
+		bk.warned = true
+		return false, warn
+	}
+	bk.tokens--
+	bk.warned = false
+	return true, false
+}
+
+// RouteStats are the counters of one route
+type RouteStats struct {
+	Route    string
+	Calls    int
+	Errors   int
+	Total    time.Duration
+	Slowest  time.Duration
+	LastCall time.Time
+}
+
+// Metrics counts calls, errors and time spent per bot and route
+type Metrics struct {
+	mu     sync.Mutex
+	routes map[string]*RouteStats
+	since  time.Time
+}
+
+// NewMetrics creates an empty set of counters
+func NewMetrics() *Metrics {
+	return &Metrics{
+		routes: make(map[string]*RouteStats),
+		since:  time.Now(),
+	}
+}
+
+// Middleware counts every update going through it
+func (m *Metrics) Middleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(b *Bot, update tgbotapi.Update) (err error) {
+			start := time.Now()
+			failed := true // stays true when the handler panics
+			defer func() {
+				m.record(b.name+" "+b.knownRoute(update), time.Since(start), failed)
+			}()
+			err = next(b, update)
+			failed = err != nil && !errors.Is(err, ErrMessageHandled)
+			return err
+		}
+	}
+}
+
+func (m *Metrics) record(route string, took time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.routes[route]
+	if !ok {
+		stats = &RouteStats{Route: route}
+		m.routes[route] = stats
+	}
+	stats.Calls++
+	if failed {
+		stats.Errors++
+	}
+	stats.Total += took
+	if took > stats.Slowest {
+		stats.Slowest = took
+	}
+	stats.LastCall = time.Now()
+}
+
+// Snapshot returns a copy of the counters, busiest routes first, and when counting started
+func (m *Metrics) Snapshot() ([]RouteStats, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]RouteStats, 0, len(m.routes))
+	for _, s := range m.routes {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Calls != stats[j].Calls {
+			return stats[i].Calls > stats[j].Calls
+		}
+		return stats[i].Route < stats[j].Route
+	})
+	return stats, m.since
+}
+
+// callbackPrefix is the part of callback data that picks the handler
+func callbackPrefix(data string) string {
+	if prefix, _, found := strings.Cut(data, ":"); found {
+		return prefix
+	}
+	return data
+}
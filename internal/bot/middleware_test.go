@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// inlineUpdate is an update that Reply does not answer, so the tests need no Bot API server
+func inlineUpdate(userID int64) tgbotapi.Update {
+	return tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{From: &tgbotapi.User{ID: userID}}}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(b *Bot, update tgbotapi.Update) error {
+				calls = append(calls, name+" before")
+				err := next(b, update)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	handler := func(b *Bot, update tgbotapi.Update) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+
+	if err := Chain(handler, trace("first"), trace("second"))(&Bot{}, inlineUpdate(1)); err != nil {
+		t.Fatalf("Chain() error = %v", err)
+	}
+	want := []string{"first before", "second before", "handler", "second after", "first after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestChainStops(t *testing.T) {
+	called := false
+	stop := func(next HandlerFunc) HandlerFunc {
+		return func(b *Bot, update tgbotapi.Update) error { return nil }
+	}
+	handler := func(b *Bot, update tgbotapi.Update) error {
+		called = true
+		return nil
+	}
+
+	if err := Chain(handler, stop)(&Bot{}, inlineUpdate(1)); err != nil {
+		t.Fatalf("Chain() error = %v", err)
+	}
+	if called {
+		t.Error("handler was called after the middleware stopped the chain")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	failure := errors.New("failed")
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		wantErr string
+	}{
+		{name: "no panic", handler: func(b *Bot, update tgbotapi.Update) error { return nil }},
+		{name: "error passes through", handler: func(b *Bot, update tgbotapi.Update) error { return failure }, wantErr: "failed"},
+		{name: "panic becomes an error", handler: func(b *Bot, update tgbotapi.Update) error { panic("boom") }, wantErr: "panic in inline: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Chain(tt.handler, Recover())(&Bot{name: "TestBot"}, inlineUpdate(1))
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("error = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+// clock is a time source the tests move by hand
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time           { return c.now }
+func (c *clock) advance(by time.Duration) { c.now = c.now.Add(by) }
+
+func TestRateLimiter(t *testing.T) {
+	type step struct {
+		after    time.Duration
+		user     int64
+		wantOK   bool
+		wantWarn bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst then deny, warn once",
+			steps: []step{
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: false, wantWarn: true},
+				{user: 1, wantOK: false},
+			},
+		},
+		{
+			name: "a token comes back every interval",
+			steps: []step{
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: true},
+				{after: 500 * time.Millisecond, user: 1, wantOK: false, wantWarn: true},
+				{after: 500 * time.Millisecond, user: 1, wantOK: true},
+				{user: 1, wantOK: false, wantWarn: true},
+			},
+		},
+		{
+			name: "the bucket never holds more than the burst",
+			steps: []step{
+				{user: 1, wantOK: true},
+				{after: time.Hour, user: 1, wantOK: true},
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: false, wantWarn: true},
+			},
+		},
+		{
+			name: "users have their own buckets",
+			steps: []step{
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: true},
+				{user: 1, wantOK: false, wantWarn: true},
+				{user: 2, wantOK: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &clock{now: time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)}
+			limiter := newRateLimiter(3, time.Second, c.Now)
+			for i, s := range tt.steps {
+				c.advance(s.after)
+				ok, warn := limiter.allow(s.user)
+				if ok != s.wantOK || warn != s.wantWarn {
+					t.Errorf("step %d: allow(%d) = %v, %v, want %v, %v", i, s.user, ok, warn, s.wantOK, s.wantWarn)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterDropsIdleBuckets(t *testing.T) {
+	c := &clock{now: time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(3, time.Second, c.Now)
+
+	limiter.allow(1)
+	limiter.allow(1)
+	limiter.allow(2)
+	c.advance(2 * time.Second)
+	limiter.allow(3)
+	if got := len(limiter.buckets); got != 3 {
+		t.Fatalf("buckets = %d, want 3", got)
+	}
+
+	// users 1 and 2 have been idle for longer than burst*interval, user 3 has not
+	c.advance(2 * time.Second)
+	limiter.allow(4)
+	if _, ok := limiter.buckets[1]; ok {
+		t.Error("idle bucket of user 1 was kept")
+	}
+	if _, ok := limiter.buckets[2]; ok {
+		t.Error("idle bucket of user 2 was kept")
+	}
+	if _, ok := limiter.buckets[3]; !ok {
+		t.Error("bucket of user 3 was dropped too early")
+	}
+
+	// a dropped user starts over with a full bucket
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow(1); !ok {
+			t.Fatalf("update %d of user 1 was refused after the bucket was dropped", i)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	calls := 0
+	handler := Chain(func(b *Bot, update tgbotapi.Update) error {
+		calls++
+		return nil
+	}, RateLimit(1, time.Hour))
+
+	// inline queries come on every keystroke and are never limited
+	for i := 0; i < 3; i++ {
+		if err := handler(&Bot{}, inlineUpdate(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("inline queries handled = %d, want 3", calls)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	b := &Bot{
+		name:     "TestBot",
+		commands: map[string]HandlerFunc{"start": nil},
+	}
+	command := func(text string) tgbotapi.Update {
+		return tgbotapi.Update{Message: &tgbotapi.Message{
+			Text:     text,
+			Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(strings.Fields(text)[0])}},
+		}}
+	}
+	metrics := NewMetrics()
+	ok := Chain(func(b *Bot, update tgbotapi.Update) error { return nil }, metrics.Middleware())
+	handled := Chain(func(b *Bot, update tgbotapi.Update) error { return ErrMessageHandled }, metrics.Middleware())
+	failing := Chain(func(b *Bot, update tgbotapi.Update) error { return errors.New("failed") }, metrics.Middleware())
+	panicking := Chain(func(b *Bot, update tgbotapi.Update) error { panic("boom") }, Recover(), metrics.Middleware())
+
+	ok(b, command("/start"))
+	handled(b, command("/start"))
+	failing(b, command("/start"))
+	panicking(b, inlineUpdate(1))
+	ok(b, command("/typo"))
+	ok(b, command("/another_typo"))
+
+	stats, _ := metrics.Snapshot()
+	got := make(map[string][2]int, len(stats))
+	for _, s := range stats {
+		got[s.Route] = [2]int{s.Calls, s.Errors}
+	}
+	want := map[string][2]int{
+		"TestBot /start":   {3, 1},
+		"TestBot /unknown": {2, 0},
+		"TestBot inline":   {1, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("calls and errors = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Admin roles, what each role may do is decided by the admin bot
+const (
+	RoleOwner  = "owner"
+	RoleHost   = "host"
+	RoleEditor = "editor"
+)
+
+// Roles lists every role, owners first
+var Roles = []string{RoleOwner, RoleHost, RoleEditor}
+
+// ErrAdminNotFound means the user is not an admin
+var ErrAdminNotFound = errors.New("admin not found")
+
+// Admin is someone allowed to use the admin bot
+type Admin struct {
+	UserID    int64
+	Username  sql.NullString
+	Role      string
+	AddedBy   sql.NullInt64
+	CreatedAt time.Time
+}
+
+type AdminsType struct {
+	db *sql.DB
+}
+
+// NewAdmins creates the admin list on top of the given database
+func NewAdmins(database *sql.DB) *AdminsType {
+	return &AdminsType{db: database}
+}
+
+// IsRole reports whether role is one of the known roles
+func IsRole(role string) bool {
+	for _, known := range Roles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns every admin, oldest first
+func (a *AdminsType) List() ([]Admin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := a.db.QueryContext(ctx, `SELECT user_id, username, role, added_by, created_at FROM admins ORDER BY created_at, user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query admins: %w", err)
+	}
+	defer rows.Close()
+
+	var admins []Admin
+	for rows.Next() {
+		var admin Admin
+		var createdAt int64
+		if err := rows.Scan(&admin.UserID, &admin.Username, &admin.Role, &admin.AddedBy, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan admin: %w", err)
+		}
+		admin.CreatedAt = time.Unix(createdAt, 0)
+		admins = append(admins, admin)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration: %w", err)
+	}
+	return admins, nil
+}
+
+// Save adds an admin or changes the role of an existing one, their stored username is kept unless a new one is given
+func (a *AdminsType) Save(admin Admin) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !IsRole(admin.Role) {
+		return fmt.Errorf("unknown role: %s", admin.Role)
+	}
+
+	query := `
+		INSERT INTO admins (user_id, username, role, added_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			username = COALESCE(excluded.username, admins.username),
+			role = excluded.role`
+	_, err := a.db.ExecContext(ctx, query,
+		admin.UserID,
+		admin.Username,
+		admin.Role,
+		admin.AddedBy,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save admin: %w", err)
+	}
+	return nil
+}
+
+// UpdateUsername remembers the current username of an admin, usernames in telegram can change
+func (a *AdminsType) UpdateUsername(userID int64, username string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := a.db.ExecContext(ctx, `UPDATE admins SET username = ? WHERE user_id = ?`,
+		sql.NullString{String: username, Valid: username != ""},
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update admin username: %w", err)
+	}
+	return nil
+}
+
+// Remove takes the admin rights away
+func (a *AdminsType) Remove(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := a.db.ExecContext(ctx, `DELETE FROM admins WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove admin: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %d", ErrAdminNotFound, userID)
+	}
+	return nil
+}
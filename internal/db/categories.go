@@ -0,0 +1,55 @@
+package db
+
+import (
+	"sort"
+	"strings"
+)
+
+// Category is a section of the songbook, Key is the short latin name used in callback data
+type Category struct {
+	Key  string
+	Name string
+}
+
+// Categories are the sections of the songbook in the order they are shown
+var Categories = []Category{
+	{"russian_rock", "русский рок"},
+	{"soviet", "советское"},
+	{"foreign", "зарубежное"},
+	{"for_kids", "детские песни"},
+	{"russian_pop", "русская поп-музыка"},
+	{"different", "разное"},
+}
+
+// CategoryByKey finds a category by its latin key
+func CategoryByKey(key string) (Category, bool) {
+	for _, category := range Categories {
+		if category.Key == key {
+			return category, true
+		}
+	}
+	return Category{}, false
+}
+
+// SongsInCategory returns the category's songs sorted by artist, then title
+func (s *SongbookType) SongsInCategory(category string) []Song {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var songs []Song
+	for _, song := range s.songs {
+		if song.Category == category {
+			songs = append(songs, song)
+		}
+	}
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		a := strings.ToLower(songs[i].Artist.String + " " + songs[i].ArtistName.String)
+		b := strings.ToLower(songs[j].Artist.String + " " + songs[j].ArtistName.String)
+		if a != b {
+			return a < b
+		}
+		return strings.ToLower(songs[i].Title) < strings.ToLower(songs[j].Title)
+	})
+	return songs
+}
@@ -5,49 +5,88 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"sync"
 	"time"
 
-	"github.com/sukalov/karaokebot/internal/utils"
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
 )
 
+const (
+	// DriverTurso is the hosted libsql database used in production
+	DriverTurso = "turso"
+	// DriverSQLite is a local database file with the same schema, for development and tests
+	DriverSQLite = "sqlite"
+)
+
+// Config tells Init which database to open
+type Config struct {
+	Driver string
+	// URL and AuthToken locate the turso database
+	URL       string
+	AuthToken string
+	// Path is the sqlite database file
+	Path string
+}
+
 var (
-	Database *sql.DB
-	once     sync.Once
-	initErr  error
+	Database     *sql.DB
+	Songbook     SongbookRepository
+	Users        UsersRepository
+	Sessions     *SessionsType
+	SongRequests *SongRequestsType
+	Admins       *AdminsType
 )
 
-// MustInit initializes the database and panics if initialization fails
-func init() {
-	once.Do(func() {
-		env, err := utils.LoadEnv([]string{"TURSO_DATABASE_URL", "TURSO_AUTH_TOKEN"})
-		if err != nil {
-			initErr = fmt.Errorf("failed to load db env: %w", err)
-			log.Fatalf("database initialization failed: %v", initErr)
-		}
-		url := fmt.Sprintf("%s?authToken=%s", env["TURSO_DATABASE_URL"], env["TURSO_AUTH_TOKEN"])
+// Init opens the configured database and loads the songbook, it must be called before using the repositories
+func Init(config Config) error {
+	var err error
+	switch config.Driver {
+	case DriverTurso, "":
+		Database, err = openTurso(config.URL, config.AuthToken)
+	case DriverSQLite:
+		Database, err = openSQLite(config.Path)
+	default:
+		return fmt.Errorf("unknown database driver: %s", config.Driver)
+	}
+	if err != nil {
+		return err
+	}
 
-		Database, initErr = sql.Open("libsql", url)
-		if initErr != nil {
-			log.Fatalf("failed to open db %s: %v", url, initErr)
-		}
+	// Verify database connection
+	if err := Database.Ping(); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
 
-		// Add connection pool configuration
-		Database.SetMaxOpenConns(25)
-		Database.SetMaxIdleConns(25)
-		Database.SetConnMaxLifetime(5 * time.Minute)
+	if err := Migrate(Database); err != nil {
+		return err
+	}
 
-		// Verify database connection
-		if pingErr := Database.Ping(); pingErr != nil {
-			log.Fatalf("failed to ping database: %v", pingErr)
-		}
-	})
+	songbook := NewSongbook(Database)
+	if err := songbook.Load(); err != nil {
+		return fmt.Errorf("failed to initialize songbook: %w", err)
+	}
 
-	// Songbook and other initializations
-	if err := Songbook.init(); err != nil {
-		log.Fatalf("failed to initialize songbook: %v", err)
+	Songbook = songbook
+	Users = NewUsers(Database)
+	Sessions = NewSessions(Database)
+	SongRequests = NewSongRequests(Database)
+	Admins = NewAdmins(Database)
+	return nil
+}
+
+func openTurso(url, authToken string) (*sql.DB, error) {
+	if url == "" || authToken == "" {
+		return nil, fmt.Errorf("turso database url and auth token are required")
 	}
+	database, err := sql.Open("libsql", fmt.Sprintf("%s?authToken=%s", url, authToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db %s: %w", url, err)
+	}
+
+	// Add connection pool configuration
+	database.SetMaxOpenConns(25)
+	database.SetMaxIdleConns(25)
+	database.SetConnMaxLifetime(5 * time.Minute)
+	return database, nil
 }
 
 // Close closes the database connection safely
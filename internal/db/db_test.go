@@ -0,0 +1,200 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// initTestDatabase runs Init on a new sqlite file and closes it when the test ends
+func initTestDatabase(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "karaoke.db")
+	if err := Init(Config{Driver: DriverSQLite, Path: path}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	t.Cleanup(Close)
+	return path
+}
+
+func TestSongbookOnSQLite(t *testing.T) {
+	initTestDatabase(t)
+	var songbook SongbookRepository = Songbook
+
+	songs := []Song{
+		{ID: "kino-gruppa", Category: "russian_rock", Title: "Группа крови", Artist: sql.NullString{String: "Кино", Valid: true}, Link: "https://example.com/1", CreatedAt: 1},
+		{ID: "kino-kukushka", Category: "russian_rock", Title: "Кукушка", Artist: sql.NullString{String: "Кино", Valid: true}, Link: "https://example.com/2", CreatedAt: 2},
+	}
+	for _, song := range songs {
+		if err := songbook.NewSong(song); err != nil {
+			t.Fatalf("NewSong(%s) error = %v", song.ID, err)
+		}
+	}
+
+	if err := songbook.IncrementSongCounter("kino-kukushka"); err != nil {
+		t.Fatalf("IncrementSongCounter() error = %v", err)
+	}
+	if err := songbook.IncrementSongCounter("missing"); err == nil {
+		t.Error("IncrementSongCounter() of a missing song error = nil")
+	}
+
+	edited := songs[0]
+	edited.AdditionalChords = sql.NullString{String: "капо на 2", Valid: true}
+	if err := songbook.UpdateSong(edited); err != nil {
+		t.Fatalf("UpdateSong() error = %v", err)
+	}
+
+	found := songbook.SearchSongs("группа крови")
+	if len(found) == 0 || found[0].ID != "kino-gruppa" {
+		t.Errorf("SearchSongs() = %+v, want kino-gruppa first", found)
+	}
+
+	// everything must have reached the database, not only the songs in memory
+	reloaded := NewSongbook(Database)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	song, ok := reloaded.FindSongByID("kino-gruppa")
+	if !ok || song.AdditionalChords.String != "капо на 2" {
+		t.Errorf("reloaded kino-gruppa = %+v, %v", song, ok)
+	}
+	if song, _ := reloaded.FindSongByID("kino-kukushka"); song.Counter != 1 {
+		t.Errorf("reloaded counter = %d, want 1", song.Counter)
+	}
+	if top := reloaded.TopSongs(5); len(top) != 1 || top[0].ID != "kino-kukushka" {
+		t.Errorf("TopSongs() = %+v, want only kino-kukushka", top)
+	}
+
+	if err := songbook.DeleteSong("kino-gruppa"); err != nil {
+		t.Fatalf("DeleteSong() error = %v", err)
+	}
+	if _, ok := songbook.FindSongByID("kino-gruppa"); ok {
+		t.Error("deleted song is still in the songbook")
+	}
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.FindSongByID("kino-gruppa"); ok {
+		t.Error("deleted song is still in the database")
+	}
+}
+
+func TestUsersOnSQLite(t *testing.T) {
+	initTestDatabase(t)
+	var users UsersRepository = Users
+
+	update := tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 100},
+		From: &tgbotapi.User{ID: 100, UserName: "Anna_K", FirstName: "Анна", LastName: "К"},
+	}}
+	// registering twice keeps a single user
+	for i := 0; i < 2; i++ {
+		if err := users.Register(update); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+	}
+
+	user, err := users.GetByChatID(100)
+	if err != nil {
+		t.Fatalf("GetByChatID() error = %v", err)
+	}
+	if user.Username.String != "Anna_K" || user.TgName.String != "Анна К" || user.SavedName.Valid {
+		t.Errorf("GetByChatID() = %+v", user)
+	}
+	if _, err := users.GetByChatID(200); err == nil {
+		t.Error("GetByChatID() of a stranger error = nil")
+	}
+
+	if err := users.UpdateSavedName(100, "анна"); err != nil {
+		t.Fatalf("UpdateSavedName() error = %v", err)
+	}
+	if err := users.IncrementTimesPerformed(100); err != nil {
+		t.Fatalf("IncrementTimesPerformed() error = %v", err)
+	}
+
+	user, err = users.GetByUsername("@anna_k")
+	if err != nil {
+		t.Fatalf("GetByUsername() error = %v", err)
+	}
+	if user.ChatID != 100 || user.SavedName.String != "анна" || user.TimesPerformed != 1 {
+		t.Errorf("GetByUsername() = %+v", user)
+	}
+
+	top, err := users.TopPerformers(5)
+	if err != nil {
+		t.Fatalf("TopPerformers() error = %v", err)
+	}
+	if len(top) != 1 || top[0].ChatID != 100 {
+		t.Errorf("TopPerformers() = %+v, want only chat 100", top)
+	}
+}
+
+func TestSessionsArchiveOnSQLite(t *testing.T) {
+	initTestDatabase(t)
+
+	session := users.Session{ID: 42, OpenedAt: time.Unix(1700000000, 0)}
+	duet := []users.Participant{{ChatID: 200, Username: "boris", Name: "борис"}}
+	entries := []users.UserState{
+		{ID: 1, ChatID: 100, TypedName: "анна", SongName: "Кукушка", Stage: users.StagePerformed, Payment: users.PaymentPaid, Participants: duet},
+		{ID: 2, ChatID: 300, TypedName: "вера", SongName: "Группа крови", Stage: users.StageInLine, Payment: users.PaymentPending},
+		{ID: 3, ChatID: 400, TypedName: "глеб", Stage: users.StageInLine},
+		{ID: 4, ChatID: 500, Stage: users.StageAskingName},
+	}
+	// archiving twice replaces the first copy
+	for i := 0; i < 2; i++ {
+		if err := Sessions.Archive(session, 300, entries); err != nil {
+			t.Fatalf("Archive() error = %v", err)
+		}
+	}
+
+	rows, err := Database.Query(`SELECT entry_id, participants, payment FROM session_entries WHERE session_id = ? ORDER BY entry_id`, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type archived struct {
+		participants []users.Participant
+		payment      sql.NullString
+	}
+	got := make(map[int]archived)
+	for rows.Next() {
+		var id int
+		var participants sql.NullString
+		var entry archived
+		if err := rows.Scan(&id, &participants, &entry.payment); err != nil {
+			t.Fatal(err)
+		}
+		if participants.Valid {
+			if err := json.Unmarshal([]byte(participants.String), &entry.participants); err != nil {
+				t.Fatalf("participants of entry %d = %q: %v", id, participants.String, err)
+			}
+		}
+		got[id] = entry
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]archived{
+		1: {participants: duet, payment: sql.NullString{String: users.PaymentPaid, Valid: true}},
+		2: {payment: sql.NullString{String: users.PaymentPending, Valid: true}},
+		3: {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archived entries = %+v, want %+v", got, want)
+	}
+
+	recent, err := Sessions.Recent(5)
+	if err != nil {
+		t.Fatalf("Recent() error = %v", err)
+	}
+	if len(recent) != 1 || recent[0].Entries != 3 || recent[0].Performed != 1 || recent[0].Price != 300 {
+		t.Errorf("Recent() = %+v, want one night with 3 entries and 1 performed", recent)
+	}
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations are applied in the order of their numeric prefix, e.g. 0003_song_requests.sql.
+// An applied migration must never be edited, add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+func loadMigrations() ([]migration, error) {
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var result []migration
+	for _, file := range files {
+		prefix, _, found := strings.Cut(file.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil {
+			return nil, fmt.Errorf("migration %s has no version prefix", file.Name())
+		}
+		content, err := migrations.ReadFile(path.Join("migrations", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file.Name(), err)
+		}
+		result = append(result, migration{version: version, name: file.Name(), sql: string(content)})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].version < result[j].version })
+	for i := 1; i < len(result); i++ {
+		if result[i].version == result[i-1].version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", result[i-1].name, result[i].name)
+		}
+	}
+	return result, nil
+}
+
+// statements splits a migration into single statements, not every driver runs several in one call.
+// A ";" ends a statement only outside quotes, comments and the BEGIN ... END body of a trigger.
+// Comments are dropped.
+func (m migration) statements() []string {
+	var (
+		result    []string
+		statement strings.Builder
+		// words are the first words of the statement, enough to tell a trigger
+		words []string
+		depth int
+	)
+	flush := func() {
+		if text := strings.TrimSpace(statement.String()); text != "" {
+			result = append(result, text)
+		}
+		statement.Reset()
+		words = words[:0]
+		depth = 0
+	}
+
+	sql := m.sql
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end == -1 {
+				end = len(sql) - i
+			}
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				i = len(sql)
+			} else {
+				i += 2 + end + 2
+			}
+			statement.WriteByte(' ')
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			// a quote inside is written twice, which reads as two quoted parts in a row
+			end := strings.IndexByte(sql[i+1:], closing)
+			if end == -1 {
+				end = len(sql) - i - 1
+			} else {
+				end++
+			}
+			statement.WriteString(sql[i : i+1+end])
+			i += 1 + end
+		case isWordByte(c):
+			start := i
+			for i < len(sql) && isWordByte(sql[i]) {
+				i++
+			}
+			word := strings.ToUpper(sql[start:i])
+			statement.WriteString(sql[start:i])
+			if len(words) < 3 {
+				words = append(words, word)
+			}
+			if isTrigger(words) {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					depth--
+				}
+			}
+		case c == ';' && depth <= 0:
+			flush()
+			i++
+		default:
+			statement.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+	return result
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isTrigger tells from the first words whether the statement is CREATE [TEMP] TRIGGER
+func isTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+	if words[1] == "TRIGGER" {
+		return true
+	}
+	return len(words) == 3 && (words[1] == "TEMP" || words[1] == "TEMPORARY") && words[2] == "TRIGGER"
+}
+
+// Migrate brings the schema up to the latest version, each migration runs in its own transaction
+func Migrate(database *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	all, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	_, err = database.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	var current int
+	if err := database.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range all {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, database, m); err != nil {
+			return err
+		}
+		log.Printf("applied database migration %s", m.name)
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, database *sql.DB, m migration) (err error) {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.Printf("error rolling back migration %s: %v", m.name, rollbackErr)
+			}
+		}
+	}()
+
+	for _, statement := range m.statements() {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now().Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", m.name, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", m.name, err)
+	}
+	return nil
+}
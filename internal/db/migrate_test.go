@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "one per semicolon",
+			sql:  "CREATE TABLE a (id INTEGER);\n\nCREATE TABLE b (id INTEGER);\n",
+			want: []string{"CREATE TABLE a (id INTEGER)", "CREATE TABLE b (id INTEGER)"},
+		},
+		{
+			name: "last statement without semicolon",
+			sql:  "CREATE TABLE a (id INTEGER);\nCREATE TABLE b (id INTEGER)",
+			want: []string{"CREATE TABLE a (id INTEGER)", "CREATE TABLE b (id INTEGER)"},
+		},
+		{
+			name: "comments are dropped",
+			sql:  "-- the first table; with a note\nCREATE TABLE a (id INTEGER); -- trailing; note\n/* block; comment */CREATE TABLE b (id INTEGER);",
+			want: []string{"CREATE TABLE a (id INTEGER)", "CREATE TABLE b (id INTEGER)"},
+		},
+		{
+			name: "semicolon in a string",
+			sql:  "INSERT INTO notes (text) VALUES ('one; two');\nINSERT INTO notes (text) VALUES ('three');",
+			want: []string{"INSERT INTO notes (text) VALUES ('one; two')", "INSERT INTO notes (text) VALUES ('three')"},
+		},
+		{
+			name: "escaped quote in a string",
+			sql:  "INSERT INTO notes (text) VALUES ('it''s; fine');SELECT 1;",
+			want: []string{"INSERT INTO notes (text) VALUES ('it''s; fine')", "SELECT 1"},
+		},
+		{
+			name: "comment markers in a string",
+			sql:  "INSERT INTO notes (text) VALUES ('-- not a comment; /* nor this */');",
+			want: []string{"INSERT INTO notes (text) VALUES ('-- not a comment; /* nor this */')"},
+		},
+		{
+			name: "quoted identifiers",
+			sql:  "CREATE TABLE \"odd;name\" (`a;b` TEXT, [c;d] TEXT);",
+			want: []string{"CREATE TABLE \"odd;name\" (`a;b` TEXT, [c;d] TEXT)"},
+		},
+		{
+			name: "trigger body",
+			sql: "CREATE TRIGGER songs_touch AFTER UPDATE ON songbook BEGIN\n" +
+				"\tUPDATE songbook SET counter = CASE WHEN counter < 0 THEN 0 ELSE counter END WHERE id = NEW.id;\n" +
+				"\tINSERT INTO log (text) VALUES ('updated; ' || NEW.id);\n" +
+				"END;\nCREATE INDEX a_id ON a (id);",
+			want: []string{
+				"CREATE TRIGGER songs_touch AFTER UPDATE ON songbook BEGIN\n" +
+					"\tUPDATE songbook SET counter = CASE WHEN counter < 0 THEN 0 ELSE counter END WHERE id = NEW.id;\n" +
+					"\tINSERT INTO log (text) VALUES ('updated; ' || NEW.id);\n" +
+					"END",
+				"CREATE INDEX a_id ON a (id)",
+			},
+		},
+		{
+			name: "temporary trigger in lower case",
+			sql:  "create temp trigger t after insert on a begin delete from b; end; select 1;",
+			want: []string{"create temp trigger t after insert on a begin delete from b; end", "select 1"},
+		},
+		{
+			name: "case outside a trigger",
+			sql:  "UPDATE a SET id = CASE WHEN id > 0 THEN id END;SELECT 1;",
+			want: []string{"UPDATE a SET id = CASE WHEN id > 0 THEN id END", "SELECT 1"},
+		},
+		{
+			name: "only comments",
+			sql:  "-- nothing to do;\n",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (migration{sql: tt.sql}).statements(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// openTestDatabase opens a new sqlite file in the test's temporary directory
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := openSQLite(filepath.Join(t.TempDir(), "karaoke.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestMigrate(t *testing.T) {
+	database := openTestDatabase(t)
+	all, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appliedVersions := func() []int {
+		t.Helper()
+		rows, err := database.Query(`SELECT version FROM schema_version ORDER BY version`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var versions []int
+		for rows.Next() {
+			var version int
+			if err := rows.Scan(&version); err != nil {
+				t.Fatal(err)
+			}
+			versions = append(versions, version)
+		}
+		return versions
+	}
+	var want []int
+	for _, m := range all {
+		want = append(want, m.version)
+	}
+
+	if err := Migrate(database); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if got := appliedVersions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("applied versions = %v, want %v", got, want)
+	}
+
+	for _, table := range []string{"songbook", "users", "sessions", "session_entries", "song_requests", "admins"} {
+		var name string
+		err := database.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&name)
+		if err != nil {
+			t.Errorf("table %s is missing: %v", table, err)
+		}
+	}
+
+	// running again on an up to date schema changes nothing
+	if _, err := database.Exec(`INSERT INTO users (chat_id, username) VALUES (1, 'anna')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(database); err != nil {
+		t.Fatalf("second Migrate() error = %v", err)
+	}
+	if got := appliedVersions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("applied versions after a second run = %v, want %v", got, want)
+	}
+	var users int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users); err != nil || users != 1 {
+		t.Errorf("users after a second run = %d, %v, want 1", users, err)
+	}
+}
+
+func TestMigrationsSplit(t *testing.T) {
+	all, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range all {
+		if len(m.statements()) == 0 {
+			t.Errorf("migration %s has no statements", m.name)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+-- the songbook and users tables as they were created by hand in the hosted database
+CREATE TABLE IF NOT EXISTS songbook (
+	id TEXT PRIMARY KEY,
+	category TEXT NOT NULL,
+	title TEXT NOT NULL,
+	artist TEXT,
+	artist_name TEXT,
+	link TEXT NOT NULL,
+	additional_chords TEXT,
+	excluded INTEGER NOT NULL DEFAULT 0,
+	counter INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	chat_id INTEGER PRIMARY KEY,
+	username TEXT,
+	tg_name TEXT,
+	saved_name TEXT,
+	added_at TEXT,
+	times_performed INTEGER NOT NULL DEFAULT 0
+);
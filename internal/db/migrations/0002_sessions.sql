@@ -0,0 +1,22 @@
+-- archived karaoke nights, see SessionsType.Archive
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY,
+	opened_at INTEGER NOT NULL,
+	closed_at INTEGER NOT NULL,
+	price INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS session_entries (
+	session_id INTEGER NOT NULL,
+	entry_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	username TEXT,
+	typed_name TEXT,
+	song_id TEXT,
+	song_name TEXT,
+	stage TEXT NOT NULL,
+	time_added INTEGER,
+	time_called INTEGER,
+	time_finished INTEGER,
+	PRIMARY KEY (session_id, entry_id)
+);
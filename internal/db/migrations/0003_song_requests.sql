@@ -0,0 +1,15 @@
+-- songs singers asked to add to the songbook, see SongRequestsType
+CREATE TABLE IF NOT EXISTS song_requests (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id INTEGER NOT NULL,
+	username TEXT,
+	artist TEXT NOT NULL,
+	title TEXT NOT NULL,
+	link TEXT,
+	status TEXT NOT NULL DEFAULT 'pending',
+	song_id TEXT,
+	created_at INTEGER NOT NULL,
+	resolved_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS song_requests_status ON song_requests (status);
@@ -0,0 +1,9 @@
+-- people who may use the admin bot, keyed by telegram user ID, see AdminsType
+CREATE TABLE IF NOT EXISTS admins (
+	user_id INTEGER PRIMARY KEY,
+	username TEXT,
+	role TEXT NOT NULL,
+	added_by INTEGER,
+	created_at INTEGER NOT NULL
+);
+
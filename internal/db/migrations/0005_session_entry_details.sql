@@ -0,0 +1,4 @@
+-- who joined a duet, as a JSON array of users.Participant, and the payment status of the entry
+ALTER TABLE session_entries ADD COLUMN participants TEXT;
+
+ALTER TABLE session_entries ADD COLUMN payment TEXT;
@@ -0,0 +1,36 @@
+package db
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SongbookRepository is the songbook the bots read and the admin bot edits
+type SongbookRepository interface {
+	ValidateCategory(category string) bool
+	FindSongByID(id string) (Song, bool)
+	FormatSongName(song Song) string
+	IncrementSongCounter(songID string) error
+	SearchSongs(query string) []Song
+	SongsInCategory(category string) []Song
+	TopSongs(limit int) []Song
+	NeverSung() []Song
+	CategoryCounters() map[string]int
+	UpdateSong(song Song) error
+	NewSong(song Song) error
+	DeleteSong(songID string) error
+}
+
+// UsersRepository keeps everyone who ever talked to the client bot
+type UsersRepository interface {
+	Register(update tgbotapi.Update) error
+	GetByChatID(chatID int64) (User, error)
+	GetByUsername(username string) (User, error)
+	UpdateSavedName(chatID int64, newName string) error
+	IncrementTimesPerformed(chatID int64) error
+	TopPerformers(limit int) ([]User, error)
+}
+
+var (
+	_ SongbookRepository = (*SongbookType)(nil)
+	_ UsersRepository    = (*UsersType)(nil)
+)
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Relevance weights, a word found in the title counts more than one found in the artist
+const (
+	titleWeight  = 3.0
+	artistWeight = 2.0
+	// wholeTitleBonus is added when the query is the whole title
+	wholeTitleBonus = 2.0
+	// popularityWeight scales the bonus for songs that are chosen often, it only reorders close matches
+	popularityWeight = 0.1
+)
+
+// Match quality of a single query word against a single word of the song
+const (
+	matchExact     = 1.0
+	matchPrefix    = 0.8
+	matchSubstring = 0.6
+	matchTypo      = 0.5
+)
+
+var translitTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// latinVariants are spellings people use interchangeably when typing russian in latin letters
+var latinVariants = strings.NewReplacer(
+	"kh", "h",
+	"j", "y",
+	"w", "v",
+	"tz", "ts",
+	"ck", "k",
+)
+
+// searchWords lowercases the text, drops punctuation and brings cyrillic and latin to the same
+// spelling, so "Кино", "kino" and "КИНО!" all become "kino" and "ёлка" matches "елка"
+func searchWords(text string) []string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case translitTable[r] != "" || r == 'ъ' || r == 'ь':
+			builder.WriteString(translitTable[r])
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune(' ')
+		}
+	}
+	return strings.Fields(latinVariants.Replace(builder.String()))
+}
+
+// maxTypos is how many edits a query word of this length may have, short words must match exactly
+func maxTypos(word string) int {
+	switch length := len([]rune(word)); {
+	case length >= 7:
+		return 2
+	case length >= 4:
+		return 1
+	}
+	return 0
+}
+
+// editDistance counts insertions, deletions, substitutions and swaps of neighbouring letters,
+// giving up with limit+1 as soon as the distance is known to exceed limit
+func editDistance(a, b []rune, limit int) int {
+	if abs(len(a)-len(b)) > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// wordMatch rates how well a query word matches a word of the song, 0 means no match
+func wordMatch(query, word string) float64 {
+	switch {
+	case query == word:
+		return matchExact
+	case strings.HasPrefix(word, query):
+		return matchPrefix
+	case len(query) >= 3 && strings.Contains(word, query):
+		return matchSubstring
+	}
+
+	limit := maxTypos(query)
+	if limit == 0 {
+		return 0
+	}
+	queryRunes, wordRunes := []rune(query), []rune(word)
+	distance := editDistance(queryRunes, wordRunes, limit)
+	// a typo in an unfinished word: compare with the beginning of the song word
+	if len(wordRunes) > len(queryRunes) {
+		distance = min(distance, editDistance(queryRunes, wordRunes[:len(queryRunes)], limit))
+	}
+	if distance > limit {
+		return 0
+	}
+	return matchTypo - 0.1*float64(distance-1)
+}
+
+func bestMatch(query string, words []string) float64 {
+	best := 0.0
+	for _, word := range words {
+		best = max(best, wordMatch(query, word))
+		if best == matchExact {
+			break
+		}
+	}
+	return best
+}
+
+// songRelevance scores the song against the query words, 0 means at least one word was not found
+func songRelevance(song Song, queryWords []string) float64 {
+	titleWords := searchWords(song.Title)
+	artistWords := searchWords(song.Artist.String + " " + song.ArtistName.String)
+
+	score := 0.0
+	for _, query := range queryWords {
+		wordScore := max(titleWeight*bestMatch(query, titleWords), artistWeight*bestMatch(query, artistWords))
+		if wordScore == 0 {
+			return 0
+		}
+		score += wordScore
+	}
+
+	if strings.Join(titleWords, " ") == strings.Join(queryWords, " ") {
+		score += wholeTitleBonus
+	}
+	return score + popularityWeight*math.Log1p(float64(song.Counter))
+}
+
+// rankSongs returns the songs matching every word of the query, most relevant first
+func rankSongs(songs []Song, query string) []Song {
+	queryWords := searchWords(query)
+	if len(queryWords) == 0 {
+		return nil
+	}
+
+	type scoredSong struct {
+		song  Song
+		score float64
+	}
+	var scored []scoredSong
+	for _, song := range songs {
+		if score := songRelevance(song, queryWords); score > 0 {
+			scored = append(scored, scoredSong{song, score})
+		}
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+
+	results := make([]Song, 0, len(scored))
+	for _, s := range scored {
+		results = append(results, s.song)
+	}
+	return results
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestSearchWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "Кино", want: []string{"kino"}},
+		{text: "kino", want: []string{"kino"}},
+		{text: "КИНО!", want: []string{"kino"}},
+		{text: "ёлка", want: []string{"elka"}},
+		{text: "елка", want: []string{"elka"}},
+		{text: "Звезда по имени Солнце", want: []string{"zvezda", "po", "imeni", "solntse"}},
+		{text: "solntze", want: []string{"solntse"}},
+		{text: "Хочу перемен", want: []string{"hochu", "peremen"}},
+		{text: "khochu", want: []string{"hochu"}},
+		{text: "объявление", want: []string{"obyavlenie"}},
+		{text: "  ...  ", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := searchWords(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchWords(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{a: "kino", b: "kino", limit: 1, want: 0},
+		{a: "kimo", b: "kino", limit: 1, want: 1},
+		{a: "kno", b: "kino", limit: 1, want: 1},
+		{a: "kiino", b: "kino", limit: 1, want: 1},
+		{a: "ikno", b: "kino", limit: 2, want: 1},
+		{a: "kion", b: "kino", limit: 1, want: 1},
+		{a: "kian", b: "kino", limit: 2, want: 2},
+		// beyond the limit the answer is limit+1, whatever the real distance
+		{a: "kian", b: "kino", limit: 1, want: 2},
+		{a: "zvezda", b: "kino", limit: 1, want: 2},
+		{a: "kinoteatr", b: "kino", limit: 2, want: 3},
+		{a: "", b: "ab", limit: 2, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := editDistance([]rune(tt.a), []rune(tt.b), tt.limit); got != tt.want {
+				t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordMatch(t *testing.T) {
+	tests := []struct {
+		query, word string
+		want        float64
+	}{
+		{query: "kino", word: "kino", want: matchExact},
+		{query: "zvez", word: "zvezda", want: matchPrefix},
+		{query: "ezd", word: "zvezda", want: matchSubstring},
+		{query: "kimo", word: "kino", want: matchTypo},
+		{query: "zvzeda", word: "zvezda", want: matchTypo},
+		{query: "zvzed", word: "zvezda", want: matchTypo},
+		{query: "gruppa", word: "gruppa", want: matchExact},
+		// short words must match exactly
+		{query: "kom", word: "kim", want: 0},
+		{query: "ab", word: "zvezda", want: 0},
+		{query: "zvezda", word: "kino", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query+"/"+tt.word, func(t *testing.T) {
+			if got := wordMatch(tt.query, tt.word); got != tt.want {
+				t.Errorf("wordMatch(%q, %q) = %v, want %v", tt.query, tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func testSong(id, title, artist string) Song {
+	return Song{ID: id, Title: title, Artist: sql.NullString{String: artist, Valid: artist != ""}}
+}
+
+func songIDs(songs []Song) []string {
+	ids := make([]string, 0, len(songs))
+	for _, song := range songs {
+		ids = append(ids, song.ID)
+	}
+	return ids
+}
+
+func TestRankSongs(t *testing.T) {
+	songs := []Song{
+		testSong("kino-zvezda", "Звезда по имени Солнце", "Кино"),
+		testSong("kino-gruppa", "Группа крови", "Кино"),
+		testSong("elka", "Ёлка", "Ундервуд"),
+		testSong("kukushka", "Кукушка", "Кино"),
+		testSong("zvezda-band", "Кукла", "Звезда"),
+		testSong("zemfira", "Хочешь?", "Земфира"),
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "ё typed as е", query: "елка", want: []string{"elka"}},
+		{name: "е typed as ё", query: "ёлка", want: []string{"elka"}},
+		{name: "latin letters", query: "kino", want: []string{"kino-zvezda", "kino-gruppa", "kukushka"}},
+		{name: "latin spelling variant", query: "khochesh", want: []string{"zemfira"}},
+		{name: "one letter typo", query: "група крови", want: []string{"kino-gruppa"}},
+		{name: "swapped letters", query: "кукшука", want: []string{"kukushka"}},
+		{name: "title above artist", query: "звезда", want: []string{"kino-zvezda", "zvezda-band"}},
+		{name: "every word must match", query: "кино земфира", want: []string{}},
+		{name: "nothing to search", query: "?!", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := songIDs(rankSongs(songs, tt.query)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankSongs(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankSongsPopularityOnlyBreaksTies(t *testing.T) {
+	exact := testSong("exact", "Кукушка", "Кино")
+	popular := testSong("popular", "Кукушка", "Полина Гагарина")
+	popular.Counter = 1000
+	prefix := testSong("prefix", "Кукушкин дом", "")
+	prefix.Counter = 100000
+
+	got := songIDs(rankSongs([]Song{prefix, exact, popular}, "кукушка"))
+	want := []string{"popular", "exact", "prefix"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankSongs() = %q, want %q", got, want)
+	}
+}
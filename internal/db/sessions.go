@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// SessionSummary is an archived karaoke night as shown in the history
+type SessionSummary struct {
+	ID        int64
+	OpenedAt  time.Time
+	ClosedAt  time.Time
+	Price     int
+	Entries   int
+	Performed int
+}
+
+type SessionsType struct {
+	db *sql.DB
+}
+
+// NewSessions creates the session archive on top of the given database
+func NewSessions(database *sql.DB) *SessionsType {
+	return &SessionsType{db: database}
+}
+
+func nullUnix(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+// nullParticipants encodes the co-singers of a duet as JSON, solo entries get NULL
+func nullParticipants(participants []users.Participant) (sql.NullString, error) {
+	if len(participants) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(participants)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// Archive saves the night with everyone who got in line, the price in effect,
+// who performed what and when, who sang along and which entries were paid
+func (s *SessionsType) Archive(session users.Session, price int, entries []users.UserState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer func() {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded {
+			logger.Error(true, fmt.Sprintf(" Query timeout after 10 seconds\nSession ID: %d", session.ID))
+		}
+	}()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logger.Error(true, fmt.Sprintf(" Error rolling back transaction\nSession ID: %d\nError: %v", session.ID, rollbackErr))
+			}
+		}
+	}()
+
+	// archiving the same night again, e.g. after clearing the line failed, replaces what was saved
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO sessions (id, opened_at, closed_at, price) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET opened_at = excluded.opened_at, closed_at = excluded.closed_at, price = excluded.price`,
+		session.ID, session.OpenedAt.Unix(), time.Now().Unix(), price,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert session: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM session_entries WHERE session_id = ?`, session.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete old session entries: %w", err)
+	}
+
+	entryQuery := `
+		INSERT INTO session_entries (
+			session_id,
+			entry_id,
+			chat_id,
+			username,
+			typed_name,
+			song_id,
+			song_name,
+			stage,
+			time_added,
+			time_called,
+			time_finished,
+			participants,
+			payment
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, entry := range entries {
+		if entry.Stage == users.StageAskingName {
+			continue
+		}
+		var participants sql.NullString
+		participants, err = nullParticipants(entry.Participants)
+		if err != nil {
+			return fmt.Errorf("failed to encode participants of entry %d: %w", entry.ID, err)
+		}
+		_, err = tx.ExecContext(ctx, entryQuery,
+			session.ID,
+			entry.ID,
+			entry.ChatID,
+			entry.Username,
+			entry.TypedName,
+			entry.SongID,
+			entry.SongName,
+			entry.Stage,
+			nullUnix(entry.TimeAdded),
+			nullUnix(entry.TimeCalled),
+			nullUnix(entry.TimeFinished),
+			participants,
+			sql.NullString{String: entry.Payment, Valid: entry.Payment != ""},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert session entry %d: %w", entry.ID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit session: %w", err)
+	}
+	return nil
+}
+
+// Recent returns the latest archived nights, newest first
+func (s *SessionsType) Recent(limit int) ([]SessionSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT s.id, s.opened_at, s.closed_at, s.price,
+			COUNT(e.entry_id),
+			COALESCE(SUM(CASE WHEN e.stage = ? THEN 1 ELSE 0 END), 0)
+		FROM sessions s
+		LEFT JOIN session_entries e ON e.session_id = s.id
+		GROUP BY s.id, s.opened_at, s.closed_at, s.price
+		ORDER BY s.opened_at DESC
+		LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, users.StagePerformed, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []SessionSummary
+	for rows.Next() {
+		var session SessionSummary
+		var openedAt, closedAt int64
+		if err := rows.Scan(&session.ID, &openedAt, &closedAt, &session.Price, &session.Entries, &session.Performed); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		session.OpenedAt = time.Unix(openedAt, 0)
+		session.ClosedAt = time.Unix(closedAt, 0)
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration: %w", err)
+	}
+	return sessions, nil
+}
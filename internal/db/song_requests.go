@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+)
+
+// SongRequest is a song a singer asked to add to the songbook
+type SongRequest struct {
+	ID         int64
+	ChatID     int64
+	Username   sql.NullString
+	Artist     string
+	Title      string
+	Link       sql.NullString
+	Status     string
+	SongID     sql.NullString
+	CreatedAt  time.Time
+	ResolvedAt time.Time
+}
+
+type SongRequestsType struct {
+	db *sql.DB
+}
+
+// NewSongRequests creates the song request box on top of the given database
+func NewSongRequests(database *sql.DB) *SongRequestsType {
+	return &SongRequestsType{db: database}
+}
+
+const songRequestColumns = `id, chat_id, username, artist, title, link, status, song_id, created_at, resolved_at`
+
+func scanSongRequest(scanner interface{ Scan(dest ...any) error }) (SongRequest, error) {
+	var request SongRequest
+	var createdAt int64
+	var resolvedAt sql.NullInt64
+	err := scanner.Scan(
+		&request.ID,
+		&request.ChatID,
+		&request.Username,
+		&request.Artist,
+		&request.Title,
+		&request.Link,
+		&request.Status,
+		&request.SongID,
+		&createdAt,
+		&resolvedAt,
+	)
+	if err != nil {
+		return SongRequest{}, err
+	}
+	request.CreatedAt = time.Unix(createdAt, 0)
+	if resolvedAt.Valid {
+		request.ResolvedAt = time.Unix(resolvedAt.Int64, 0)
+	}
+	return request, nil
+}
+
+// Create stores a new pending request and returns its ID
+func (r *SongRequestsType) Create(request SongRequest) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO song_requests (
+			chat_id,
+			username,
+			artist,
+			title,
+			link,
+			status,
+			created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query,
+		request.ChatID,
+		request.Username,
+		request.Artist,
+		request.Title,
+		request.Link,
+		RequestPending,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert song request: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get song request id: %w", err)
+	}
+	return id, nil
+}
+
+// Get returns a single request
+func (r *SongRequestsType) Get(id int64) (SongRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+songRequestColumns+` FROM song_requests WHERE id = ?`, id)
+	request, err := scanSongRequest(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SongRequest{}, fmt.Errorf("song request not found: %d", id)
+		}
+		return SongRequest{}, fmt.Errorf("failed to retrieve song request: %w", err)
+	}
+	return request, nil
+}
+
+// Pending returns the requests nobody has looked at yet, oldest first
+func (r *SongRequestsType) Pending() ([]SongRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+songRequestColumns+` FROM song_requests WHERE status = ? ORDER BY created_at, id`,
+		RequestPending,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []SongRequest
+	for rows.Next() {
+		request, err := scanSongRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration: %w", err)
+	}
+	return requests, nil
+}
+
+// Resolve approves or rejects a pending request, songID is the song added for an approved one
+func (r *SongRequestsType) Resolve(id int64, status string, songID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE song_requests SET status = ?, song_id = ?, resolved_at = ? WHERE id = ? AND status = ?`
+	result, err := r.db.ExecContext(ctx, query,
+		status,
+		sql.NullString{String: songID, Valid: songID != ""},
+		time.Now().Unix(),
+		id,
+		RequestPending,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to resolve song request: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no pending song request with id: %d", id)
+	}
+	return nil
+}
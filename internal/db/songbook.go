@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -24,20 +25,38 @@ type Song struct {
 }
 
 type SongbookType struct {
+	db    *sql.DB
 	songs []Song
 	mu    sync.RWMutex
 }
 
-var Songbook = &SongbookType{}
+// NewSongbook creates a songbook on top of the given database, call Load before using it
+func NewSongbook(database *sql.DB) *SongbookType {
+	return &SongbookType{db: database}
+}
 
-func (s *SongbookType) init() error {
+// Load reads the whole songbook into memory
+func (s *SongbookType) Load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	rows, err := Database.QueryContext(ctx, "SELECT * FROM songbook")
+	query := `
+		SELECT
+			id,
+			category,
+			title,
+			artist,
+			artist_name,
+			link,
+			additional_chords,
+			excluded,
+			counter,
+			created_at
+		FROM songbook`
+	rows, err := s.db.QueryContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -47,8 +66,7 @@ func (s *SongbookType) init() error {
 	for rows.Next() {
 		var song Song
 		if err := rows.Scan(&song.ID, &song.Category, &song.Title, &song.Artist, &song.ArtistName, &song.Link, &song.AdditionalChords, &song.Excluded, &song.Counter, &song.CreatedAt); err != nil {
-			log.Printf("error scanning row: %v", err)
-			continue
+			return fmt.Errorf("failed to scan song: %w", err)
 		}
 		songs = append(songs, song)
 	}
@@ -62,9 +80,10 @@ func (s *SongbookType) init() error {
 }
 
 func (s *SongbookType) ValidateCategory(category string) bool {
-	switch category {
-	case "русский рок", "русская поп-музыка", "советское", "детские песни", "зарубежное", "разное":
-		return true
+	for _, known := range Categories {
+		if known.Name == category {
+			return true
+		}
 	}
 	return false
 }
@@ -107,7 +126,7 @@ func (s *SongbookType) IncrementSongCounter(songID string) error {
 		}
 	}()
 
-	result, err := Database.ExecContext(ctx, query, songID)
+	result, err := s.db.ExecContext(ctx, query, songID)
 	if err != nil {
 		return fmt.Errorf("failed to increment song counter: %w", err)
 	}
@@ -124,38 +143,57 @@ func (s *SongbookType) IncrementSongCounter(songID string) error {
 	return nil
 }
 
+// SearchSongs finds songs by title and artist, forgiving typos, ё and russian typed in latin letters.
+// Results are sorted by relevance.
 func (s *SongbookType) SearchSongs(query string) []Song {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	query = strings.ToLower(query)
-	queryParts := strings.Fields(query)
+	return rankSongs(s.songs, query)
+}
 
-	var results []Song
+// TopSongs returns the most chosen songs, most popular first
+func (s *SongbookType) TopSongs(limit int) []Song {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	var songs []Song
 	for _, song := range s.songs {
-		title := strings.ToLower(song.Title)
-		artist := strings.ToLower(song.Artist.String)
-		artistName := strings.ToLower(song.ArtistName.String)
-
-		allPartsMatch := true
-		for _, part := range queryParts {
-			matches := strings.Contains(title, part) ||
-				strings.Contains(artist, part) ||
-				strings.Contains(artistName, part)
-
-			if !matches {
-				allPartsMatch = false
-				break
-			}
+		if song.Counter > 0 {
+			songs = append(songs, song)
 		}
+	}
+	sort.SliceStable(songs, func(i, j int) bool { return songs[i].Counter > songs[j].Counter })
+	if len(songs) > limit {
+		songs = songs[:limit]
+	}
+	return songs
+}
 
-		if allPartsMatch {
-			results = append(results, song)
+// NeverSung returns the songs in the songbook nobody has chosen yet
+func (s *SongbookType) NeverSung() []Song {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var songs []Song
+	for _, song := range s.songs {
+		if song.Counter == 0 && song.Excluded == 0 {
+			songs = append(songs, song)
 		}
 	}
+	return songs
+}
 
-	return results
+// CategoryCounters sums up how many times songs of each category were chosen
+func (s *SongbookType) CategoryCounters() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counters := make(map[string]int)
+	for _, song := range s.songs {
+		counters[song.Category] += song.Counter
+	}
+	return counters
 }
 
 func (s *SongbookType) UpdateSong(song Song) error {
@@ -182,7 +220,7 @@ func (s *SongbookType) UpdateSong(song Song) error {
 		}
 	}()
 
-	result, err := Database.ExecContext(ctx, query,
+	result, err := s.db.ExecContext(ctx, query,
 		song.Category,
 		song.Title,
 		song.Link,
@@ -246,7 +284,7 @@ func (s *SongbookType) NewSong(song Song) error {
 		}
 	}()
 
-	result, err := Database.ExecContext(ctx, query,
+	result, err := s.db.ExecContext(ctx, query,
 		song.Category,
 		song.Title,
 		song.Link,
@@ -290,7 +328,7 @@ func (s *SongbookType) DeleteSong(songID string) error {
 		}
 	}()
 
-	result, err := Database.ExecContext(ctx, query, songID)
+	result, err := s.db.ExecContext(ctx, query, songID)
 	if err != nil {
 		return fmt.Errorf("failed to delete song from database: %w", err)
 	}
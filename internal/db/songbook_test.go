@@ -0,0 +1,24 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSongbookLoadFailsOnBadRow(t *testing.T) {
+	database := openTestDatabase(t)
+	if err := Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	_, err := database.Exec(`INSERT INTO songbook (id, category, title, link, excluded, created_at) VALUES
+		('good', 'russian_rock', 'кукушка', 'https://example.com/1', 0, 1),
+		('bad', 'russian_rock', 'группа крови', 'https://example.com/2', 'maybe', 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewSongbook(database).Load()
+	if err == nil || !strings.Contains(err.Error(), "failed to scan song") {
+		t.Errorf("Load() error = %v, want a scan error", err)
+	}
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -20,9 +21,17 @@ type User struct {
 	TimesPerformed int
 }
 
-type UsersType struct{}
+// ErrUserNotFound means nobody with this username has talked to the client bot
+var ErrUserNotFound = errors.New("user not found")
 
-var Users = &UsersType{}
+type UsersType struct {
+	db *sql.DB
+}
+
+// NewUsers creates the users table accessor on top of the given database
+func NewUsers(database *sql.DB) *UsersType {
+	return &UsersType{db: database}
+}
 
 func (u *UsersType) Register(update tgbotapi.Update) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -46,7 +55,7 @@ func (u *UsersType) Register(update tgbotapi.Update) error {
 		Valid: false,
 	}
 
-	tx, err := Database.BeginTx(ctx, nil)
+	tx, err := u.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -117,7 +126,7 @@ func (u *UsersType) GetByChatID(chatID int64) (User, error) {
 	var timestampStr string
 	query := `SELECT chat_id, username, tg_name, saved_name, added_at, times_performed
 			  FROM users WHERE chat_id = ?`
-	err := Database.QueryRowContext(ctx, query, chatID).Scan(
+	err := u.db.QueryRowContext(ctx, query, chatID).Scan(
 		&user.ChatID,
 		&user.Username,
 		&user.TgName,
@@ -135,6 +144,31 @@ func (u *UsersType) GetByChatID(chatID int64) (User, error) {
 	return user, nil
 }
 
+// GetByUsername finds a user by telegram username, without the @ and ignoring case
+func (u *UsersType) GetByUsername(username string) (User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user User
+	query := `SELECT chat_id, username, tg_name, saved_name, times_performed
+			  FROM users WHERE lower(username) = lower(?) LIMIT 1`
+	err := u.db.QueryRowContext(ctx, query, strings.TrimPrefix(username, "@")).Scan(
+		&user.ChatID,
+		&user.Username,
+		&user.TgName,
+		&user.SavedName,
+		&user.TimesPerformed,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+		}
+		return User{}, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	return user, nil
+}
+
 func (u *UsersType) UpdateSavedName(chatID int64, newName string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer func() {
@@ -145,7 +179,7 @@ func (u *UsersType) UpdateSavedName(chatID int64, newName string) error {
 	}()
 
 	query := `UPDATE users SET saved_name = ? WHERE chat_id = ?`
-	result, err := Database.ExecContext(ctx, query, newName, chatID)
+	result, err := u.db.ExecContext(ctx, query, newName, chatID)
 	if err != nil {
 		return fmt.Errorf("failed to update saved name: %w", err)
 	}
@@ -168,7 +202,7 @@ func (u *UsersType) IncrementTimesPerformed(chatID int64) error {
 
 	query := `UPDATE users SET times_performed = times_performed + 1 WHERE chat_id = ?`
 
-	result, err := Database.ExecContext(ctx, query, chatID)
+	result, err := u.db.ExecContext(ctx, query, chatID)
 	if err != nil {
 		return fmt.Errorf("failed to increment times performed: %w", err)
 	}
@@ -184,3 +218,32 @@ func (u *UsersType) IncrementTimesPerformed(chatID int64) error {
 
 	return nil
 }
+
+// TopPerformers returns the users who signed up to sing the most
+func (u *UsersType) TopPerformers(limit int) ([]User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `SELECT chat_id, username, tg_name, saved_name, times_performed
+			  FROM users WHERE times_performed > 0
+			  ORDER BY times_performed DESC LIMIT ?`
+	rows, err := u.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top performers: %w", err)
+	}
+	defer rows.Close()
+
+	var result []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ChatID, &user.Username, &user.TgName, &user.SavedName, &user.TimesPerformed); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		result = append(result, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration: %w", err)
+	}
+	return result, nil
+}
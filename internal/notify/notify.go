@@ -0,0 +1,96 @@
+// Package notify delivers queue notifications to singers through the client bot.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/state"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// Sender is the part of a bot the notifier needs to reach users
+type Sender interface {
+	SendMessage(chatID int64, text string) error
+}
+
+// Notifier tells singers that their turn is coming
+type Notifier struct {
+	sender   Sender
+	mu       sync.Mutex
+	notified map[int]int // entry ID -> closest position the singer was told about
+}
+
+// New creates a notifier that sends messages with the given bot
+func New(sender Sender) *Notifier {
+	return &Notifier{
+		sender:   sender,
+		notified: make(map[int]int),
+	}
+}
+
+// Attach subscribes the notifier to queue changes of the state manager
+func (n *Notifier) Attach(userManager *state.StateManager) {
+	userManager.Subscribe(func(ctx context.Context, event state.Event) {
+		switch event.Type {
+		case state.EventQueueAdvanced:
+			n.notifyUpcoming(userManager.GetQueue())
+		case state.EventQueueChanged:
+			// reordering before the show has started is not worth a message
+			if _, performing := userManager.GetCurrent(); performing {
+				n.notifyUpcoming(userManager.GetQueue())
+			}
+		}
+	})
+}
+
+// Notify sends a single message to a user in the background
+func (n *Notifier) Notify(chatID int64, text string) {
+	if chatID == 0 {
+		return
+	}
+	go func() {
+		if err := n.sender.SendMessage(chatID, text); err != nil {
+			logger.Error(false, fmt.Sprintf(" Failed to notify user\nChat ID: %d\nError: %v", chatID, err))
+		}
+	}()
+}
+
+func upcomingMessage(position int, entry users.UserState) string {
+	name := strings.ReplaceAll(entry.TypedName, "\\_", "_")
+	if position == 1 {
+		return fmt.Sprintf("🎤 %s, вы следующий! песня \"%s\". подходите к сцене", name, entry.SongName)
+	}
+	return fmt.Sprintf("%s, через одну песню ваша очередь (\"%s\"). готовьтесь!", name, entry.SongName)
+}
+
+// notifyUpcoming messages the first two singers in line, each about a given position only once
+func (n *Notifier) notifyUpcoming(queue []users.UserState) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	upcoming := make(map[int]bool)
+	for i, entry := range queue {
+		if i >= 2 {
+			break
+		}
+		position := i + 1
+		upcoming[entry.ID] = true
+		if told, ok := n.notified[entry.ID]; ok && told <= position {
+			continue
+		}
+		n.notified[entry.ID] = position
+		for _, chatID := range entry.ChatIDs() {
+			n.Notify(chatID, upcomingMessage(position, entry))
+		}
+	}
+
+	for id := range n.notified {
+		if !upcoming[id] {
+			delete(n.notified, id)
+		}
+	}
+}
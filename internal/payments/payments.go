@@ -0,0 +1,113 @@
+// Package payments builds Telegram invoices for songs and checks the payments that come back for them.
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// Currency of every invoice, prices are set in rubles
+const Currency = "RUB"
+
+// payloadPrefix marks invoices for entries in the line: entry:<entry ID>:<amount>
+const payloadPrefix = "entry:"
+
+var (
+	// ErrBadPayload means the payment is not for one of our invoices
+	ErrBadPayload = errors.New("unknown invoice payload")
+	// ErrEntryGone means the entry left the line before it was paid for
+	ErrEntryGone = errors.New("entry is no longer in line")
+	// ErrAlreadyPaid means the entry has been paid for already
+	ErrAlreadyPaid = errors.New("entry is already paid")
+	// ErrWrongPayer means somebody else is paying for the entry
+	ErrWrongPayer = errors.New("entry belongs to another user")
+	// ErrWrongAmount means the payment does not match the invoice
+	ErrWrongAmount = errors.New("amount does not match the invoice")
+)
+
+// Provider issues invoices through the payment provider connected in BotFather.
+// A provider without a token is disabled, singers then pay by transfer.
+type Provider struct {
+	token string
+}
+
+func New(providerToken string) *Provider {
+	return &Provider{token: providerToken}
+}
+
+// Enabled reports whether invoices can be sent
+func (p *Provider) Enabled() bool {
+	return p != nil && p.token != ""
+}
+
+// Amount converts rubles to kopecks, the smallest units Telegram expects
+func Amount(price int) int {
+	return price * 100
+}
+
+// Order is what an invoice was issued for
+type Order struct {
+	EntryID int
+	Amount  int
+}
+
+func payload(entryID, amount int) string {
+	return fmt.Sprintf("%s%d:%d", payloadPrefix, entryID, amount)
+}
+
+// ParsePayload reads the order back from the payload of an invoice
+func ParsePayload(text string) (Order, error) {
+	rest, found := strings.CutPrefix(text, payloadPrefix)
+	if !found {
+		return Order{}, ErrBadPayload
+	}
+	idText, amountText, found := strings.Cut(rest, ":")
+	if !found {
+		return Order{}, ErrBadPayload
+	}
+	entryID, err := strconv.Atoi(idText)
+	if err != nil {
+		return Order{}, ErrBadPayload
+	}
+	amount, err := strconv.Atoi(amountText)
+	if err != nil {
+		return Order{}, ErrBadPayload
+	}
+	return Order{EntryID: entryID, Amount: amount}, nil
+}
+
+// Invoice asks the singer to pay price rubles for the entry
+func (p *Provider) Invoice(entry users.UserState, price int) tgbotapi.InvoiceConfig {
+	amount := Amount(price)
+	return tgbotapi.NewInvoice(
+		entry.ChatID,
+		"песня в караоке",
+		fmt.Sprintf("«%s», поёт %s", entry.SongName, strings.ReplaceAll(entry.TypedName, "\\_", "_")),
+		payload(entry.ID, amount),
+		p.token,
+		"",
+		Currency,
+		[]tgbotapi.LabeledPrice{{Label: "песня", Amount: amount}},
+	)
+}
+
+// Check makes sure the payment can be taken for the entry: it is still waiting, not paid yet,
+// the payer signed up for it and the amount is the one on the invoice
+func Check(order Order, entry users.UserState, found bool, payerID int64, currency string, total int) error {
+	switch {
+	case !found || entry.IsFinished():
+		return ErrEntryGone
+	case entry.Payment == users.PaymentPaid:
+		return ErrAlreadyPaid
+	case entry.ChatID != payerID:
+		return ErrWrongPayer
+	case currency != Currency || total != order.Amount:
+		return ErrWrongAmount
+	}
+	return nil
+}
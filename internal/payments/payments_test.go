@@ -0,0 +1,81 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+func TestParsePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    Order
+		wantErr error
+	}{
+		{name: "valid", payload: "entry:12:50000", want: Order{EntryID: 12, Amount: 50000}},
+		{name: "round trip", payload: payload(7, Amount(300)), want: Order{EntryID: 7, Amount: 30000}},
+		{name: "empty", payload: "", wantErr: ErrBadPayload},
+		{name: "other prefix", payload: "donation:12:50000", wantErr: ErrBadPayload},
+		{name: "no amount", payload: "entry:12", wantErr: ErrBadPayload},
+		{name: "bad id", payload: "entry:x:50000", wantErr: ErrBadPayload},
+		{name: "bad amount", payload: "entry:12:lots", wantErr: ErrBadPayload},
+		{name: "extra part", payload: "entry:12:500:1", wantErr: ErrBadPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePayload(tt.payload)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParsePayload(%q) error = %v, want %v", tt.payload, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePayload(%q) = %+v, want %+v", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	const payer = int64(100)
+	order := Order{EntryID: 1, Amount: Amount(500)}
+	waiting := users.UserState{ID: 1, ChatID: payer, Stage: users.StageInLine}
+
+	with := func(edit func(entry *users.UserState)) users.UserState {
+		entry := waiting
+		edit(&entry)
+		return entry
+	}
+
+	tests := []struct {
+		name     string
+		entry    users.UserState
+		found    bool
+		payerID  int64
+		currency string
+		total    int
+		wantErr  error
+	}{
+		{name: "ok", entry: waiting, found: true, payerID: payer, currency: Currency, total: order.Amount},
+		{name: "pending screenshot can still be paid", entry: with(func(e *users.UserState) { e.Payment = users.PaymentPending }), found: true, payerID: payer, currency: Currency, total: order.Amount},
+		{name: "on stage can still be paid", entry: with(func(e *users.UserState) { e.Stage = users.StagePerforming }), found: true, payerID: payer, currency: Currency, total: order.Amount},
+		{name: "entry gone", found: false, payerID: payer, currency: Currency, total: order.Amount, wantErr: ErrEntryGone},
+		{name: "entry performed", entry: with(func(e *users.UserState) { e.Stage = users.StagePerformed }), found: true, payerID: payer, currency: Currency, total: order.Amount, wantErr: ErrEntryGone},
+		{name: "entry skipped", entry: with(func(e *users.UserState) { e.Stage = users.StageSkipped }), found: true, payerID: payer, currency: Currency, total: order.Amount, wantErr: ErrEntryGone},
+		{name: "already paid", entry: with(func(e *users.UserState) { e.Payment = users.PaymentPaid }), found: true, payerID: payer, currency: Currency, total: order.Amount, wantErr: ErrAlreadyPaid},
+		{name: "co-singer pays", entry: with(func(e *users.UserState) { e.Participants = []users.Participant{{ChatID: 200}} }), found: true, payerID: 200, currency: Currency, total: order.Amount, wantErr: ErrWrongPayer},
+		{name: "stranger pays", entry: waiting, found: true, payerID: 300, currency: Currency, total: order.Amount, wantErr: ErrWrongPayer},
+		{name: "wrong currency", entry: waiting, found: true, payerID: payer, currency: "USD", total: order.Amount, wantErr: ErrWrongAmount},
+		{name: "price changed", entry: waiting, found: true, payerID: payer, currency: Currency, total: Amount(300), wantErr: ErrWrongAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(order, tt.entry, tt.found, tt.payerID, tt.currency, tt.total)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	redisClient "github.com/go-redis/redis/v8"
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+const (
+	// entriesKey is a hash of queue entries, field is the entry ID and value is the entry JSON
+	entriesKey = "queue:entries"
+	// legacyListKey held the whole queue as one JSON array before entries got their own fields
+	legacyListKey = "list"
+	// entryIDKey is the counter queue entry IDs are allocated from
+	entryIDKey = "entry_id"
+)
+
+// LoadEntries returns all queue entries sorted by ID, which is the order they were created in
+func (s *Store) LoadEntries(ctx context.Context) ([]users.UserState, error) {
+	if err := s.migrateLegacyList(ctx); err != nil {
+		return nil, err
+	}
+
+	data, err := s.client.HGetAll(ctx, entriesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]users.UserState, 0, len(data))
+	for _, value := range data {
+		var entry users.UserState
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// SaveEntries writes the given entries in one MULTI/EXEC, other entries are left untouched
+func (s *Store) SaveEntries(ctx context.Context, entries ...users.UserState) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, len(entries)*2)
+	for _, entry := range entries {
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		values = append(values, strconv.Itoa(entry.ID), entryJSON)
+	}
+	_, err := s.client.TxPipelined(ctx, func(pipe redisClient.Pipeliner) error {
+		pipe.HSet(ctx, entriesKey, values...)
+		return nil
+	})
+	return err
+}
+
+// DeleteEntry removes a single entry from the queue
+func (s *Store) DeleteEntry(ctx context.Context, id int) error {
+	return s.client.HDel(ctx, entriesKey, strconv.Itoa(id)).Err()
+}
+
+// Reset removes every entry and applies the settings in one MULTI/EXEC, a nil setting is deleted
+func (s *Store) Reset(ctx context.Context, settings map[string]interface{}) error {
+	values := make(map[string][]byte, len(settings))
+	for key, value := range settings {
+		if value == nil {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		values[key] = data
+	}
+	_, err := s.client.TxPipelined(ctx, func(pipe redisClient.Pipeliner) error {
+		pipe.Del(ctx, entriesKey)
+		for key := range settings {
+			if data, ok := values[key]; ok {
+				pipe.Set(ctx, key, data, 0)
+			} else {
+				pipe.Del(ctx, key)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// migrateLegacyList moves the queue from the old single JSON blob into the entries hash
+func (s *Store) migrateLegacyList(ctx context.Context) error {
+	data, err := s.client.Get(ctx, legacyListKey).Bytes()
+	if err != nil {
+		if err == redisClient.Nil {
+			return nil
+		}
+		return err
+	}
+
+	var list []users.UserState
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	// legacy IDs were len(list)+1 and could repeat, the hash would keep only one entry per ID
+	if err := s.renumberDuplicates(ctx, list); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, 0, len(list)*2)
+	for _, entry := range list {
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		values = append(values, strconv.Itoa(entry.ID), entryJSON)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redisClient.Pipeliner) error {
+		if len(values) > 0 {
+			pipe.HSet(ctx, entriesKey, values...)
+		}
+		pipe.Del(ctx, legacyListKey)
+		return nil
+	})
+	return err
+}
+
+// renumberDuplicates gives entries whose ID is already taken a new one from the entry ID counter
+func (s *Store) renumberDuplicates(ctx context.Context, list []users.UserState) error {
+	maxID := 0
+	for _, entry := range list {
+		if entry.ID > maxID {
+			maxID = entry.ID
+		}
+	}
+	if err := s.RaiseEntryID(ctx, maxID); err != nil {
+		return err
+	}
+
+	seen := make(map[int]bool, len(list))
+	for i, entry := range list {
+		if !seen[entry.ID] {
+			seen[entry.ID] = true
+			continue
+		}
+		id, err := s.NextEntryID(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Info(false, fmt.Sprintf("Renumbered duplicate legacy entry %d to %d\nName: %s\nSong: %s", entry.ID, id, entry.TypedName, entry.SongName))
+		list[i].ID = id
+		seen[id] = true
+	}
+	return nil
+}
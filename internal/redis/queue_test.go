@@ -0,0 +1,173 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redisClient "github.com/go-redis/redis/v8"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redisClient.NewClient(&redisClient.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return &Store{client: client}, server
+}
+
+func legacyEntry(id int, name string) users.UserState {
+	return users.UserState{ID: id, ChatID: int64(100 + id), TypedName: name, SongName: "песня " + name, Stage: users.StageInLine}
+}
+
+func setLegacyList(t *testing.T, server *miniredis.Miniredis, list []users.UserState) {
+	t.Helper()
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Set(legacyListKey, string(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLegacyList(t *testing.T) {
+	tests := []struct {
+		name      string
+		counter   string
+		list      []users.UserState
+		wantIDs   map[string]int
+		wantCount string
+	}{
+		{
+			name:      "unique IDs are kept",
+			list:      []users.UserState{legacyEntry(1, "анна"), legacyEntry(2, "борис"), legacyEntry(3, "вера")},
+			wantIDs:   map[string]int{"анна": 1, "борис": 2, "вера": 3},
+			wantCount: "3",
+		},
+		{
+			name: "duplicates get new IDs after the largest one",
+			list: []users.UserState{
+				legacyEntry(1, "анна"), legacyEntry(2, "борис"), legacyEntry(2, "вера"), legacyEntry(3, "глеб"), legacyEntry(3, "дина"),
+			},
+			wantIDs:   map[string]int{"анна": 1, "борис": 2, "вера": 4, "глеб": 3, "дина": 5},
+			wantCount: "5",
+		},
+		{
+			name:      "duplicates get IDs after the counter when it is ahead",
+			counter:   "10",
+			list:      []users.UserState{legacyEntry(1, "анна"), legacyEntry(1, "борис")},
+			wantIDs:   map[string]int{"анна": 1, "борис": 11},
+			wantCount: "11",
+		},
+		{
+			name:    "empty list",
+			list:    []users.UserState{},
+			wantIDs: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, server := newTestStore(t)
+			if tt.counter != "" {
+				server.Set(entryIDKey, tt.counter)
+			}
+			setLegacyList(t, server, tt.list)
+
+			entries, err := store.LoadEntries(ctx)
+			if err != nil {
+				t.Fatalf("LoadEntries() error = %v", err)
+			}
+			got := make(map[string]int, len(entries))
+			for _, entry := range entries {
+				got[entry.TypedName] = entry.ID
+			}
+			if !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("IDs = %v, want %v", got, tt.wantIDs)
+			}
+			for _, entry := range entries {
+				if entry.SongName != "песня "+entry.TypedName || entry.Stage != users.StageInLine {
+					t.Errorf("entry %d lost its contents: %+v", entry.ID, entry)
+				}
+			}
+
+			if server.Exists(legacyListKey) {
+				t.Error("legacy list is still there")
+			}
+			if tt.wantCount != "" {
+				if counter, _ := server.Get(entryIDKey); counter != tt.wantCount {
+					t.Errorf("entry ID counter = %q, want %q", counter, tt.wantCount)
+				}
+			}
+
+			// loading again reads the migrated hash and changes nothing
+			again, err := store.LoadEntries(ctx)
+			if err != nil {
+				t.Fatalf("second LoadEntries() error = %v", err)
+			}
+			if !reflect.DeepEqual(again, entries) {
+				t.Errorf("second LoadEntries() = %+v, want %+v", again, entries)
+			}
+		})
+	}
+}
+
+func TestMigrateBrokenLegacyListKeepsIt(t *testing.T) {
+	store, server := newTestStore(t)
+	server.Set(legacyListKey, "[{not json")
+
+	if _, err := store.LoadEntries(context.Background()); err == nil {
+		t.Fatal("LoadEntries() error = nil")
+	}
+	if value, _ := server.Get(legacyListKey); value != "[{not json" {
+		t.Errorf("legacy list = %q, want it untouched", value)
+	}
+}
+
+func TestLoadEntriesWithoutLegacyList(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	if err := store.SaveEntries(ctx, legacyEntry(2, "борис"), legacyEntry(1, "анна")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.LoadEntries(ctx)
+	if err != nil {
+		t.Fatalf("LoadEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != 1 || entries[1].ID != 2 {
+		t.Errorf("LoadEntries() = %+v, want entries 1 and 2 in order", entries)
+	}
+}
+
+func TestRaiseEntryID(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	steps := []struct {
+		raise  int
+		wantID int
+	}{
+		{raise: 5, wantID: 6},
+		{raise: 3, wantID: 7},
+		{raise: 7, wantID: 8},
+		{raise: 20, wantID: 21},
+	}
+	for _, step := range steps {
+		if err := store.RaiseEntryID(ctx, step.raise); err != nil {
+			t.Fatalf("RaiseEntryID(%d) error = %v", step.raise, err)
+		}
+		id, err := store.NextEntryID(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != step.wantID {
+			t.Errorf("NextEntryID() after RaiseEntryID(%d) = %d, want %d", step.raise, id, step.wantID)
+		}
+	}
+}
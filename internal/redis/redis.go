@@ -3,46 +3,37 @@ package redis
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
 	redisClient "github.com/go-redis/redis/v8"
-	"github.com/sukalov/karaokebot/internal/utils"
 )
 
-var Client *redisClient.Client
-
-type RedisClient *redisClient.Client
-
-func init() {
-	env, err := utils.LoadEnv([]string{"REDIS_URL", "REDIS_PASSWORD"})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to load redis db env %s.", err)
-		os.Exit(1)
-	}
+// Store keeps the line and its settings in redis
+type Store struct {
+	client *redisClient.Client
+}
 
-	opt, err := redisClient.ParseURL(fmt.Sprintf("rediss://default:%s@%s", env["REDIS_PASSWORD"], env["REDIS_URL"]))
+// New connects to redis and checks the connection with a ping
+func New(url, password string) (*Store, error) {
+	opt, err := redisClient.ParseURL(fmt.Sprintf("rediss://default:%s@%s", password, url))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse redis URL: %s.", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to parse redis URL: %w", err)
 	}
 
-	Client = redisClient.NewClient(opt)
+	client := redisClient.NewClient(opt)
 
 	// Ping to verify connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = Client.Ping(ctx).Result()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to connect to redis: %s.", err)
-		os.Exit(1)
+	if _, err := client.Ping(ctx).Result(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
+	return &Store{client: client}, nil
 }
 
 // Close closes the redis connection
-func Close() {
-	if Client != nil {
-		Client.Close()
-	}
+func (s *Store) Close() error {
+	return s.client.Close()
 }
@@ -0,0 +1,45 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// ErrAlreadySinging means the chat is already one of the entry's singers
+var ErrAlreadySinging = errors.New("already singing this song")
+
+// AddParticipant adds a co-singer to an entry that is waiting in line, their name is added to the entry's name.
+// The song counts toward the co-singer's limits, a *LimitError is returned when it would break one.
+func (sm *StateManager) AddParticipant(ctx context.Context, stateID int, participant users.Participant) (users.UserState, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for i, state := range sm.list {
+		if state.ID != stateID {
+			continue
+		}
+		if state.Stage != users.StageInLine {
+			return state, fmt.Errorf("state with ID %d is not waiting in line", stateID)
+		}
+		if state.HasSinger(participant.ChatID) {
+			return state, ErrAlreadySinging
+		}
+		if err := sm.checkLimits(participant.ChatID); err != nil {
+			return state, err
+		}
+
+		state.Participants = append(append([]users.Participant(nil), state.Participants...), participant)
+		state.TypedName = fmt.Sprintf("%s и %s", state.TypedName, participant.Name)
+		if err := sm.store.SaveEntries(ctx, state); err != nil {
+			logger.Error(false, fmt.Sprintf(" Error updating stored list\nError: %v", err))
+			return state, err
+		}
+		sm.list[i] = state
+		return state, nil
+	}
+	return users.UserState{}, fmt.Errorf("state with ID %d not found", stateID)
+}
@@ -0,0 +1,95 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+const (
+	defaultSongMinutes = 5
+	// minObservedSongs is how many performances are needed before the real pace replaces the configured one
+	minObservedSongs = 3
+)
+
+func (sm *StateManager) GetSongDuration() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.songDuration
+}
+
+func (sm *StateManager) SetSongDuration(ctx context.Context, minutes int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.songDuration = minutes
+	if err := sm.store.Save(ctx, keySongDuration, minutes); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored song duration\nError: %v", err))
+		return err
+	}
+	return nil
+}
+
+// Pace returns how long one turn on stage takes on average. Once a few songs have been
+// performed tonight it is measured from them, before that the configured duration is used.
+func (sm *StateManager) Pace() time.Duration {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.pace()
+}
+
+// pace must be called with the lock held
+func (sm *StateManager) pace() time.Duration {
+	var first, last time.Time
+	performed := 0
+	for _, state := range sm.list {
+		if state.Stage != users.StagePerformed || state.TimeCalled.IsZero() || state.TimeFinished.IsZero() {
+			continue
+		}
+		performed++
+		if first.IsZero() || state.TimeCalled.Before(first) {
+			first = state.TimeCalled
+		}
+		if state.TimeFinished.After(last) {
+			last = state.TimeFinished
+		}
+	}
+
+	if performed >= minObservedSongs && last.After(first) {
+		return last.Sub(first) / time.Duration(performed)
+	}
+	return time.Duration(sm.songDuration) * time.Minute
+}
+
+// Position returns the 1-based place of the entry among those still waiting
+func (sm *StateManager) Position(stateID int) (int, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	for i, state := range sm.queue() {
+		if state.ID == stateID {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// EstimateWait returns roughly how long the singer at the given position has to wait
+// before being called to the stage
+func (sm *StateManager) EstimateWait(position int) time.Duration {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	pace := sm.pace()
+	wait := time.Duration(position-1) * pace
+	for _, state := range sm.list {
+		if state.Stage == users.StagePerforming {
+			if remaining := pace - time.Since(state.TimeCalled); remaining > 0 {
+				wait += remaining
+			}
+			break
+		}
+	}
+	return wait
+}
@@ -0,0 +1,83 @@
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// NoLimit turns a limit off
+const NoLimit = 0
+
+// legacyNoLimit is what /limit used to store instead of turning the limit off
+const legacyNoLimit = 1000
+
+// LimitError tells which limit one more song would break
+type LimitError struct {
+	Limit int
+	// Waiting is set when the singer already has too many songs waiting in line,
+	// otherwise they have used up the songs for the night
+	Waiting bool
+}
+
+func (e *LimitError) Error() string {
+	if e.Waiting {
+		return fmt.Sprintf("waiting limit of %d songs reached", e.Limit)
+	}
+	return fmt.Sprintf("limit of %d songs per night reached", e.Limit)
+}
+
+// GetWaitingLimit is how many songs a singer may have waiting in line at the same time
+func (sm *StateManager) GetWaitingLimit() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.waitingLimit
+}
+
+func (sm *StateManager) SetWaitingLimit(ctx context.Context, limit int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.waitingLimit = limit
+	if err := sm.store.Save(ctx, keyWaitingLimit, limit); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored waiting limit\nError: %v", err))
+		return err
+	}
+	return nil
+}
+
+// checkLimits returns a *LimitError when one more song for the singer would break a limit.
+// Songs sung together with someone count for every participant. Must be called with the lock held,
+// in the same step that adds the song, so two quick taps cannot both get the last place.
+func (sm *StateManager) checkLimits(chatID int64) error {
+	total, waiting := 0, 0
+	for _, state := range sm.list {
+		if !state.HasSinger(chatID) {
+			continue
+		}
+		total++
+		if state.Stage == users.StageAskingName || state.Stage == users.StageInLine {
+			waiting++
+		}
+	}
+
+	if sm.limit != NoLimit && total >= sm.limit {
+		return &LimitError{Limit: sm.limit}
+	}
+	if sm.waitingLimit != NoLimit && waiting >= sm.waitingLimit {
+		return &LimitError{Limit: sm.waitingLimit, Waiting: true}
+	}
+	return nil
+}
+
+// AddUserWithinLimits adds the entry like AddUser unless it would break a limit of the singer,
+// then a *LimitError is returned and nothing is added
+func (sm *StateManager) AddUserWithinLimits(ctx context.Context, state users.UserState) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if err := sm.checkLimits(state.ChatID); err != nil {
+		return err
+	}
+	return sm.addUser(ctx, state)
+}
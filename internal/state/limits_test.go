@@ -0,0 +1,131 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// newLimitedManager creates a state manager with the limits stored as they would be before a restart
+func newLimitedManager(t *testing.T, limit, waitingLimit int, entries ...users.UserState) *StateManager {
+	t.Helper()
+	ctx := context.Background()
+	store, err := NewMemoryStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, keyLimit, limit); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, keyWaitingLimit, waitingLimit); err != nil {
+		t.Fatal(err)
+	}
+	sm := NewStateManager(store)
+	if err := sm.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := sm.AddUser(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sm
+}
+
+func TestAddUserWithinLimits(t *testing.T) {
+	performed := func(id int, chatID int64, coSingers ...int64) users.UserState {
+		return withStage(waiting(id, chatID, coSingers...), users.StagePerformed)
+	}
+	askingName := func(id int, chatID int64) users.UserState {
+		return withStage(waiting(id, chatID), users.StageAskingName)
+	}
+
+	tests := []struct {
+		name         string
+		limit        int
+		waitingLimit int
+		entries      []users.UserState
+		want         *LimitError
+	}{
+		{name: "first song", limit: 3},
+		{name: "under the night limit", limit: 3, entries: []users.UserState{performed(1, anna), waiting(2, anna)}},
+		{name: "night limit counts performed songs", limit: 3, entries: []users.UserState{performed(1, anna), performed(2, anna), waiting(3, anna)}, want: &LimitError{Limit: 3}},
+		{name: "no limit", limit: NoLimit, entries: []users.UserState{performed(1, anna), performed(2, anna), performed(3, anna), waiting(4, anna), waiting(5, anna)}},
+		{name: "legacy 1000 means no limit", limit: legacyNoLimit, entries: []users.UserState{performed(1, anna), performed(2, anna), performed(3, anna), waiting(4, anna)}},
+		{name: "waiting limit", limit: NoLimit, waitingLimit: 1, entries: []users.UserState{waiting(1, anna)}, want: &LimitError{Limit: 1, Waiting: true}},
+		{name: "asking name counts as waiting", limit: NoLimit, waitingLimit: 1, entries: []users.UserState{askingName(1, anna)}, want: &LimitError{Limit: 1, Waiting: true}},
+		{name: "performed songs are not waiting", limit: NoLimit, waitingLimit: 1, entries: []users.UserState{performed(1, anna), performed(2, anna)}},
+		{name: "night limit goes before waiting limit", limit: 2, waitingLimit: 1, entries: []users.UserState{waiting(1, anna), waiting(2, anna)}, want: &LimitError{Limit: 2}},
+		{name: "a duet counts for the co-singer", limit: 2, entries: []users.UserState{performed(1, boris, anna), waiting(2, anna)}, want: &LimitError{Limit: 2}},
+		{name: "a waiting duet counts for the co-singer", limit: NoLimit, waitingLimit: 1, entries: []users.UserState{waiting(1, boris, anna)}, want: &LimitError{Limit: 1, Waiting: true}},
+		{name: "other singers do not count", limit: 1, waitingLimit: 1, entries: []users.UserState{waiting(1, boris), waiting(2, vera)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newLimitedManager(t, tt.limit, tt.waitingLimit, tt.entries...)
+			err := sm.AddUserWithinLimits(context.Background(), waiting(10, anna))
+
+			var limitErr *LimitError
+			switch {
+			case tt.want == nil && err != nil:
+				t.Fatalf("AddUserWithinLimits() error = %v", err)
+			case tt.want != nil && !errors.As(err, &limitErr):
+				t.Fatalf("AddUserWithinLimits() error = %v, want %v", err, tt.want)
+			case tt.want != nil && *limitErr != *tt.want:
+				t.Errorf("AddUserWithinLimits() error = %+v, want %+v", *limitErr, *tt.want)
+			}
+
+			if _, added := sm.Get(10); added != (tt.want == nil) {
+				t.Errorf("entry added = %v, want %v", added, tt.want == nil)
+			}
+		})
+	}
+}
+
+func TestLegacyLimitIsTurnedOff(t *testing.T) {
+	sm := newLimitedManager(t, legacyNoLimit, NoLimit)
+	if got := sm.GetLimit(); got != NoLimit {
+		t.Errorf("GetLimit() = %d, want %d", got, NoLimit)
+	}
+}
+
+func TestAddParticipantChecksLimits(t *testing.T) {
+	ctx := context.Background()
+	sm := newLimitedManager(t, 1, NoLimit, waiting(1, anna), waiting(2, boris))
+
+	_, err := sm.AddParticipant(ctx, 2, users.Participant{ChatID: anna, Name: "анна"})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || *limitErr != (LimitError{Limit: 1}) {
+		t.Fatalf("AddParticipant() error = %v, want the night limit", err)
+	}
+	if entry, _ := sm.Get(2); len(entry.Participants) != 0 {
+		t.Errorf("participants = %+v, want none", entry.Participants)
+	}
+
+	if _, err := sm.AddParticipant(ctx, 2, users.Participant{ChatID: vera, Name: "вера"}); err != nil {
+		t.Fatalf("AddParticipant() error = %v", err)
+	}
+}
+
+func TestLimitsHoldForConcurrentSignups(t *testing.T) {
+	ctx := context.Background()
+	sm := newLimitedManager(t, 1, NoLimit)
+
+	var wg sync.WaitGroup
+	for id := 1; id <= 10; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			sm.AddUserWithinLimits(ctx, waiting(id, anna))
+		}(id)
+	}
+	wg.Wait()
+
+	if got := len(sm.GetAllThisUser(anna)); got != 1 {
+		t.Errorf("songs signed up = %d, want 1", got)
+	}
+}
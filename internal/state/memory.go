@@ -0,0 +1,188 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// MemoryStore keeps the line in memory, for running locally without redis.
+// With a file path every change is also written to that file and read back on start.
+type MemoryStore struct {
+	mu       sync.Mutex
+	path     string
+	entries  map[int]users.UserState
+	settings map[string]json.RawMessage
+	lastID   int
+}
+
+type memorySnapshot struct {
+	Entries  []users.UserState          `json:"entries"`
+	Settings map[string]json.RawMessage `json:"settings"`
+	LastID   int                        `json:"last_id"`
+}
+
+// NewMemoryStore creates a memory store, an empty path keeps nothing between restarts
+func NewMemoryStore(path string) (*MemoryStore, error) {
+	store := &MemoryStore{
+		path:     path,
+		entries:  make(map[int]users.UserState),
+		settings: make(map[string]json.RawMessage),
+	}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var snapshot memorySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	for _, entry := range snapshot.Entries {
+		store.entries[entry.ID] = entry
+	}
+	if snapshot.Settings != nil {
+		store.settings = snapshot.Settings
+	}
+	store.lastID = snapshot.LastID
+	return store, nil
+}
+
+// persist writes everything to the file through a temporary one, so a crash never leaves half a file.
+// Must be called with the lock held.
+func (s *MemoryStore) persist() error {
+	if s.path == "" {
+		return nil
+	}
+	snapshot := memorySnapshot{
+		Entries:  s.sortedEntries(),
+		Settings: s.settings,
+		LastID:   s.lastID,
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+func (s *MemoryStore) sortedEntries() []users.UserState {
+	list := make([]users.UserState, 0, len(s.entries))
+	for _, entry := range s.entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *MemoryStore) LoadEntries(ctx context.Context) ([]users.UserState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedEntries(), nil
+}
+
+func (s *MemoryStore) SaveEntries(ctx context.Context, entries ...users.UserState) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		s.entries[entry.ID] = entry
+	}
+	return s.persist()
+}
+
+func (s *MemoryStore) DeleteEntry(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return s.persist()
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, settings map[string]interface{}) error {
+	values := make(map[string]json.RawMessage, len(settings))
+	for key, value := range settings {
+		if value == nil {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		values[key] = data
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[int]users.UserState)
+	for key := range settings {
+		if data, ok := values[key]; ok {
+			s.settings[key] = data
+		} else {
+			delete(s.settings, key)
+		}
+	}
+	return s.persist()
+}
+
+func (s *MemoryStore) NextEntryID(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	if err := s.persist(); err != nil {
+		return 0, err
+	}
+	return s.lastID, nil
+}
+
+func (s *MemoryStore) RaiseEntryID(ctx context.Context, minID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastID >= minID {
+		return nil
+	}
+	s.lastID = minID
+	return s.persist()
+}
+
+func (s *MemoryStore) Load(ctx context.Context, key string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.settings[key]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *MemoryStore) Save(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[key] = data
+	return s.persist()
+}
@@ -0,0 +1,206 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// restart loads a new state manager from the file, like the bot does after a restart
+func restart(t *testing.T, path string) *StateManager {
+	t.Helper()
+	store, err := NewMemoryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewStateManager(store)
+	if err := sm.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+func TestMemoryStoreIDsAreNeverReused(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+	sm := restart(t, path)
+
+	for want := 1; want <= 3; want++ {
+		id, err := sm.NextID(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Fatalf("NextID() = %d, want %d", id, want)
+		}
+		if err := sm.AddUser(ctx, waiting(id, anna)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sm.RemoveState(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := sm.NextID(ctx); id != 4 {
+		t.Errorf("NextID() after remove = %d, want 4", id)
+	}
+
+	if id, _ := restart(t, path).NextID(ctx); id != 5 {
+		t.Errorf("NextID() after restart = %d, want 5", id)
+	}
+}
+
+func TestMemoryStoreRaisesIDsOverLoadedEntries(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemoryStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// entries written before the counter was kept
+	if err := store.SaveEntries(ctx, waiting(7, anna), waiting(3, boris)); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewStateManager(store)
+	if err := sm.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := sm.NextID(ctx); id != 8 {
+		t.Errorf("NextID() = %d, want 8", id)
+	}
+}
+
+func TestMemoryStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+	sm := restart(t, path)
+
+	duet := waiting(2, boris, anna)
+	duet.Participants[0].Name = "анна"
+	duet.Payment = users.PaymentPending
+	for _, entry := range []users.UserState{withStage(waiting(1, anna), users.StagePerformed), duet, waiting(3, 0)} {
+		if err := sm.AddUser(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.MoveToTop(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.OpenList(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetLimit(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetWaitingLimit(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetPrice(ctx, 500); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetOrdering(ctx, OrderingRoundRobin); err != nil {
+		t.Fatal(err)
+	}
+	methods := []PaymentMethod{{Name: "сбп", Details: "+7 900 000-00-00 анна"}}
+	if err := sm.SetPaymentMethods(ctx, methods); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := restart(t, path)
+	if got, want := restored.GetAll(), sm.GetAll(); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %+v, want %+v", got, want)
+	}
+	if got, want := queueIDs(restored), queueIDs(sm); !reflect.DeepEqual(got, want) {
+		t.Errorf("queue = %v, want %v", got, want)
+	}
+	if !restored.IsOpen() {
+		t.Error("list is closed after restart")
+	}
+	if got := restored.GetLimit(); got != 2 {
+		t.Errorf("GetLimit() = %d, want 2", got)
+	}
+	if got := restored.GetWaitingLimit(); got != 1 {
+		t.Errorf("GetWaitingLimit() = %d, want 1", got)
+	}
+	if got := restored.GetPrice(); got != 500 {
+		t.Errorf("GetPrice() = %d, want 500", got)
+	}
+	if got := restored.GetOrdering(); got != OrderingRoundRobin {
+		t.Errorf("GetOrdering() = %q, want %q", got, OrderingRoundRobin)
+	}
+	if got := restored.GetPaymentMethods(); !reflect.DeepEqual(got, methods) {
+		t.Errorf("GetPaymentMethods() = %+v, want %+v", got, methods)
+	}
+}
+
+func TestMemoryStoreWithoutFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "missing.json")
+	store, err := NewMemoryStore(path)
+	if err != nil {
+		t.Fatalf("NewMemoryStore() with no file yet error = %v", err)
+	}
+	entries, err := store.LoadEntries(ctx)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("LoadEntries() = %v, %v, want no entries", entries, err)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMemoryStore(path); err == nil {
+		t.Error("NewMemoryStore() with a broken file error = nil")
+	}
+}
+
+func TestMemoryStoreWritesThroughTemporaryFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := NewMemoryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveEntries(ctx, waiting(1, anna)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file is left behind: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(data) {
+		t.Fatalf("state file is not valid JSON: %s", data)
+	}
+
+	// when the temporary file cannot be written the state file must stay as it was
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveEntries(ctx, waiting(2, boris)); err == nil {
+		t.Fatal("SaveEntries() error = nil, want the write to fail")
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(data) {
+		t.Errorf("state file changed by a failed write:\n%s\nwant:\n%s", after, data)
+	}
+
+	reloaded, err := NewMemoryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := reloaded.LoadEntries(ctx)
+	if len(entries) != 1 || entries[0].ID != 1 {
+		t.Errorf("entries after a failed write = %+v, want only entry 1", entries)
+	}
+}
@@ -0,0 +1,177 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+const (
+	// OrderingFIFO calls singers in the order they signed up
+	OrderingFIFO = "fifo"
+	// OrderingRoundRobin lets everyone sing their first song before anyone sings a second one
+	OrderingRoundRobin = "round_robin"
+)
+
+// ErrOrderingConflict means the ordering strategy does not allow the requested move
+var ErrOrderingConflict = errors.New("move conflicts with the ordering strategy")
+
+func (sm *StateManager) GetOrdering() string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.ordering
+}
+
+func (sm *StateManager) SetOrdering(ctx context.Context, ordering string) error {
+	if ordering != OrderingFIFO && ordering != OrderingRoundRobin {
+		return fmt.Errorf("unknown ordering: %s", ordering)
+	}
+	sm.mu.Lock()
+	sm.ordering = ordering
+	err := sm.store.Save(ctx, keyOrdering, ordering)
+	sm.mu.Unlock()
+	if err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored ordering\nError: %v", err))
+		return err
+	}
+	sm.emit(ctx, Event{Type: EventQueueChanged})
+	return nil
+}
+
+// singerKeys identifies everyone singing an entry, walk-ins without a chat are each their own singer
+func singerKeys(state users.UserState) []int64 {
+	chatIDs := state.ChatIDs()
+	if len(chatIDs) == 0 {
+		return []int64{-int64(state.ID)}
+	}
+	return chatIDs
+}
+
+// interleave reorders a queue sorted by order into rounds: a singer's n-th song tonight
+// goes to round n, counting the songs already performed. A duet counts for every singer in it
+// and goes to the round of the one who has sung the most. Must be called with the lock held.
+func (sm *StateManager) interleave(queue []users.UserState) {
+	sung := make(map[int64]int)
+	for _, state := range sm.list {
+		if state.Stage == users.StagePerforming || state.Stage == users.StagePerformed {
+			for _, key := range singerKeys(state) {
+				sung[key]++
+			}
+		}
+	}
+
+	rounds := make(map[int]int, len(queue))
+	for _, state := range queue {
+		keys := singerKeys(state)
+		round := 0
+		for _, key := range keys {
+			if sung[key] > round {
+				round = sung[key]
+			}
+		}
+		rounds[state.ID] = round
+		for _, key := range keys {
+			sung[key] = round + 1
+		}
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool { return rounds[queue[i].ID] < rounds[queue[j].ID] })
+}
+
+// MoveUp swaps the entry with the one waiting right before it
+func (sm *StateManager) MoveUp(ctx context.Context, stateID int) error {
+	return sm.reorder(ctx, stateID, func(queue []users.UserState, index int) []users.UserState {
+		if index > 0 {
+			swap(queue, index-1, index)
+		}
+		return queue
+	})
+}
+
+// MoveDown swaps the entry with the one waiting right after it
+func (sm *StateManager) MoveDown(ctx context.Context, stateID int) error {
+	return sm.reorder(ctx, stateID, func(queue []users.UserState, index int) []users.UserState {
+		if index < len(queue)-1 {
+			swap(queue, index, index+1)
+		}
+		return queue
+	})
+}
+
+// swap exchanges two neighbouring entries, an explicit move unpins them so their order alone decides
+func swap(queue []users.UserState, i, j int) {
+	queue[i], queue[j] = queue[j], queue[i]
+	queue[i].Pinned = false
+	queue[j].Pinned = false
+}
+
+// MoveToTop makes the entry the next one to be called, ahead of any ordering strategy
+func (sm *StateManager) MoveToTop(ctx context.Context, stateID int) error {
+	return sm.reorder(ctx, stateID, func(queue []users.UserState, index int) []users.UserState {
+		entry := queue[index]
+		entry.Pinned = true
+		copy(queue[1:index+1], queue[:index])
+		queue[0] = entry
+		return queue
+	})
+}
+
+// reorder rearranges the waiting entries with place and stores the result as their explicit order
+func (sm *StateManager) reorder(ctx context.Context, stateID int, place func(queue []users.UserState, index int) []users.UserState) error {
+	sm.mu.Lock()
+	queue := sm.queue()
+	index := -1
+	for i, state := range queue {
+		if state.ID == stateID {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		sm.mu.Unlock()
+		return fmt.Errorf("state with ID %d is not waiting in line", stateID)
+	}
+
+	// edit a copy, the old list may still be read by whoever got it from GetAll
+	previous := sm.list
+	sm.list = make([]users.UserState, len(previous))
+	copy(sm.list, previous)
+
+	queue = place(queue, index)
+	placed := make(map[int]users.UserState, len(queue))
+	for i, state := range queue {
+		state.Order = i + 1
+		placed[state.ID] = state
+	}
+	changed := make([]users.UserState, 0, len(placed))
+	for i, state := range sm.list {
+		if update, ok := placed[state.ID]; ok {
+			sm.list[i].Order = update.Order
+			sm.list[i].Pinned = update.Pinned
+			changed = append(changed, sm.list[i])
+		}
+	}
+
+	// the strategy may still put entries elsewhere, e.g. between rounds of round-robin
+	for i, state := range sm.queue() {
+		if state.ID != queue[i].ID {
+			sm.list = previous
+			sm.mu.Unlock()
+			return ErrOrderingConflict
+		}
+	}
+
+	err := sm.store.SaveEntries(ctx, changed...)
+	sm.mu.Unlock()
+	if err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored list\nError: %v", err))
+		return err
+	}
+
+	sm.emit(ctx, Event{Type: EventQueueChanged})
+	return nil
+}
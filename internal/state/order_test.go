@@ -0,0 +1,278 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+var signupStart = time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)
+
+// newTestManager creates a state manager over a memory store with the entries already added
+func newTestManager(t *testing.T, entries ...users.UserState) *StateManager {
+	t.Helper()
+	store, err := NewMemoryStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewStateManager(store)
+	if err := sm.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := sm.AddUser(context.Background(), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sm
+}
+
+// waiting is an entry waiting in line, signed up in the order of the IDs
+func waiting(id int, chatID int64, coSingers ...int64) users.UserState {
+	entry := users.UserState{
+		ID:        id,
+		ChatID:    chatID,
+		Stage:     users.StageInLine,
+		TimeAdded: signupStart.Add(time.Duration(id) * time.Minute),
+	}
+	for _, coSinger := range coSingers {
+		entry.Participants = append(entry.Participants, users.Participant{ChatID: coSinger})
+	}
+	return entry
+}
+
+func withStage(entry users.UserState, stage string) users.UserState {
+	entry.Stage = stage
+	return entry
+}
+
+func pinned(entry users.UserState) users.UserState {
+	entry.Pinned = true
+	return entry
+}
+
+func queueIDs(sm *StateManager) []int {
+	ids := []int{}
+	for _, entry := range sm.GetQueue() {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+const (
+	anna  = int64(1)
+	boris = int64(2)
+	vera  = int64(3)
+	gleb  = int64(4)
+)
+
+func TestQueueOrdering(t *testing.T) {
+	tests := []struct {
+		name     string
+		ordering string
+		entries  []users.UserState
+		want     []int
+	}{
+		{
+			name:     "fifo keeps the signup order",
+			ordering: OrderingFIFO,
+			entries:  []users.UserState{waiting(1, anna), waiting(2, anna), waiting(3, boris), waiting(4, vera)},
+			want:     []int{1, 2, 3, 4},
+		},
+		{
+			name:     "three singers with three songs each",
+			ordering: OrderingRoundRobin,
+			entries: []users.UserState{
+				waiting(1, anna), waiting(2, anna), waiting(3, anna),
+				waiting(4, boris), waiting(5, boris), waiting(6, boris),
+				waiting(7, vera), waiting(8, vera), waiting(9, vera),
+			},
+			want: []int{1, 4, 7, 2, 5, 8, 3, 6, 9},
+		},
+		{
+			name:     "three singers with different numbers of songs",
+			ordering: OrderingRoundRobin,
+			entries: []users.UserState{
+				waiting(1, anna), waiting(2, anna), waiting(3, anna),
+				waiting(4, boris),
+				waiting(5, vera), waiting(6, vera),
+			},
+			want: []int{1, 4, 5, 2, 6, 3},
+		},
+		{
+			name:     "songs sung tonight count",
+			ordering: OrderingRoundRobin,
+			entries: []users.UserState{
+				withStage(waiting(1, anna), users.StagePerformed),
+				waiting(2, anna), waiting(3, boris),
+			},
+			want: []int{3, 2},
+		},
+		{
+			name:     "a duet counts for the co-singer",
+			ordering: OrderingRoundRobin,
+			entries:  []users.UserState{waiting(1, anna, boris), waiting(2, boris), waiting(3, vera)},
+			want:     []int{1, 3, 2},
+		},
+		{
+			name:     "a performed duet counts for the co-singer",
+			ordering: OrderingRoundRobin,
+			entries: []users.UserState{
+				withStage(waiting(1, anna, boris), users.StagePerformed),
+				waiting(2, boris), waiting(3, vera),
+			},
+			want: []int{3, 2},
+		},
+		{
+			name:     "a duet waits for the singer who has sung more",
+			ordering: OrderingRoundRobin,
+			entries: []users.UserState{
+				waiting(1, anna), waiting(2, anna, boris), waiting(3, boris), waiting(4, vera),
+			},
+			want: []int{1, 4, 2, 3},
+		},
+		{
+			name:     "walk-ins are different singers",
+			ordering: OrderingRoundRobin,
+			entries:  []users.UserState{waiting(1, anna), waiting(2, anna), waiting(3, 0), waiting(4, 0)},
+			want:     []int{1, 3, 4, 2},
+		},
+		{
+			name:     "pinned entries go first in fifo",
+			ordering: OrderingFIFO,
+			entries:  []users.UserState{waiting(1, anna), waiting(2, boris), pinned(waiting(3, vera))},
+			want:     []int{3, 1, 2},
+		},
+		{
+			name:     "pinned entries go first in round robin",
+			ordering: OrderingRoundRobin,
+			entries:  []users.UserState{waiting(1, anna), waiting(2, anna), waiting(3, boris), pinned(waiting(4, anna))},
+			want:     []int{4, 1, 3, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestManager(t, tt.entries...)
+			if err := sm.SetOrdering(context.Background(), tt.ordering); err != nil {
+				t.Fatal(err)
+			}
+			if got := queueIDs(sm); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoves(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		move       func(sm *StateManager, id int) error
+		id         int
+		want       []int
+		wantPinned int
+	}{
+		{name: "up from the top", move: (*StateManager).moveUp, id: 1, want: []int{1, 2, 3, 4}},
+		{name: "up from the middle", move: (*StateManager).moveUp, id: 3, want: []int{1, 3, 2, 4}},
+		{name: "up from the bottom", move: (*StateManager).moveUp, id: 4, want: []int{1, 2, 4, 3}},
+		{name: "down from the top", move: (*StateManager).moveDown, id: 1, want: []int{2, 1, 3, 4}},
+		{name: "down from the middle", move: (*StateManager).moveDown, id: 2, want: []int{1, 3, 2, 4}},
+		{name: "down from the bottom", move: (*StateManager).moveDown, id: 4, want: []int{1, 2, 3, 4}},
+		{name: "to the top from the bottom", move: (*StateManager).moveToTop, id: 4, want: []int{4, 1, 2, 3}, wantPinned: 4},
+		{name: "to the top from the top", move: (*StateManager).moveToTop, id: 1, want: []int{1, 2, 3, 4}, wantPinned: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestManager(t, waiting(1, anna), waiting(2, boris), waiting(3, vera), waiting(4, gleb))
+			if err := tt.move(sm, tt.id); err != nil {
+				t.Fatalf("move error = %v", err)
+			}
+			if got := queueIDs(sm); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queue = %v, want %v", got, tt.want)
+			}
+			for _, entry := range sm.GetQueue() {
+				if entry.Pinned != (entry.ID == tt.wantPinned) {
+					t.Errorf("entry %d pinned = %v", entry.ID, entry.Pinned)
+				}
+			}
+
+			// the new order must survive a restart
+			restored := NewStateManager(sm.store)
+			if err := restored.Init(); err != nil {
+				t.Fatal(err)
+			}
+			if got := queueIDs(restored); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("restored queue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("entry not in line", func(t *testing.T) {
+		sm := newTestManager(t, waiting(1, anna), withStage(waiting(2, boris), users.StagePerformed))
+		for _, id := range []int{2, 9} {
+			if err := sm.MoveUp(ctx, id); err == nil {
+				t.Errorf("MoveUp(%d) error = nil", id)
+			}
+		}
+	})
+
+	t.Run("a move unpins the entries", func(t *testing.T) {
+		sm := newTestManager(t, waiting(1, anna), waiting(2, boris), waiting(3, vera))
+		if err := sm.MoveToTop(ctx, 3); err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.MoveDown(ctx, 3); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := queueIDs(sm), []int{1, 3, 2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("queue = %v, want %v", got, want)
+		}
+		for _, entry := range sm.GetQueue() {
+			if entry.Pinned {
+				t.Errorf("entry %d is still pinned", entry.ID)
+			}
+		}
+	})
+}
+
+func (sm *StateManager) moveUp(id int) error    { return sm.MoveUp(context.Background(), id) }
+func (sm *StateManager) moveDown(id int) error  { return sm.MoveDown(context.Background(), id) }
+func (sm *StateManager) moveToTop(id int) error { return sm.MoveToTop(context.Background(), id) }
+
+func TestMoveConflictRollsBack(t *testing.T) {
+	ctx := context.Background()
+	sm := newTestManager(t, waiting(1, anna), waiting(2, boris), waiting(3, anna))
+	if err := sm.SetOrdering(ctx, OrderingRoundRobin); err != nil {
+		t.Fatal(err)
+	}
+	before := sm.GetAll()
+
+	// anna's second song cannot go before boris's first one in round robin
+	if err := sm.MoveUp(ctx, 3); !errors.Is(err, ErrOrderingConflict) {
+		t.Fatalf("MoveUp() error = %v, want %v", err, ErrOrderingConflict)
+	}
+	if got := sm.GetAll(); !reflect.DeepEqual(got, before) {
+		t.Errorf("entries after conflict = %+v, want %+v", got, before)
+	}
+	stored, err := sm.store.LoadEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, before) {
+		t.Errorf("stored entries after conflict = %+v, want %+v", stored, before)
+	}
+
+	// moves within a round still work after the rollback
+	if err := sm.MoveDown(ctx, 1); err != nil {
+		t.Fatalf("MoveDown() error = %v", err)
+	}
+	if got, want := queueIDs(sm), []int{2, 1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queue = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+)
+
+// PaymentMethod is one way to pay for a song, singers see it on paid nights
+type PaymentMethod struct {
+	// Name is what the method is called, e.g. "сбп"
+	Name string `json:"name"`
+	// Details are the link or the phone number with the recipient's name
+	Details string `json:"details"`
+}
+
+func (sm *StateManager) GetPaymentMethods() []PaymentMethod {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return append([]PaymentMethod(nil), sm.paymentMethods...)
+}
+
+func (sm *StateManager) SetPaymentMethods(ctx context.Context, methods []PaymentMethod) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.paymentMethods = append([]PaymentMethod(nil), methods...)
+	if err := sm.store.Save(ctx, keyPaymentMethods, sm.paymentMethods); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored payment methods\nError: %v", err))
+		return err
+	}
+	return nil
+}
+
+// Key identifies the method by its contents, so a button made for it never hits another one
+func (m PaymentMethod) Key() string {
+	hash := fnv.New64a()
+	hash.Write([]byte(m.Name + "\n" + m.Details))
+	return fmt.Sprintf("%x", hash.Sum64())
+}
+
+// RemovePaymentMethod deletes the method with the key, it reports false when there is no such method anymore
+func (sm *StateManager) RemovePaymentMethod(ctx context.Context, key string) (PaymentMethod, bool, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for i, method := range sm.paymentMethods {
+		if method.Key() != key {
+			continue
+		}
+		methods := append(append([]PaymentMethod(nil), sm.paymentMethods[:i]...), sm.paymentMethods[i+1:]...)
+		if err := sm.store.Save(ctx, keyPaymentMethods, methods); err != nil {
+			logger.Error(false, fmt.Sprintf(" Error updating stored payment methods\nError: %v", err))
+			return method, false, err
+		}
+		sm.paymentMethods = methods
+		return method, true, nil
+	}
+	return PaymentMethod{}, false, nil
+}
@@ -0,0 +1,99 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// GetHoldUnpaid reports whether entries are kept out of the queue until their payment is confirmed
+func (sm *StateManager) GetHoldUnpaid() bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.holdUnpaid
+}
+
+func (sm *StateManager) SetHoldUnpaid(ctx context.Context, hold bool) error {
+	sm.mu.Lock()
+	sm.holdUnpaid = hold
+	err := sm.store.Save(ctx, keyHoldUnpaid, hold)
+	sm.mu.Unlock()
+	if err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored hold unpaid setting\nError: %v", err))
+		return err
+	}
+	sm.emit(ctx, Event{Type: EventQueueChanged})
+	return nil
+}
+
+// IsHeld reports whether the entry waits for its payment to be confirmed before it gets a place in the queue
+func (sm *StateManager) IsHeld(entry users.UserState) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.isHeld(entry)
+}
+
+// isHeld must be called with the lock held. Entries added by admins are paid at the door.
+func (sm *StateManager) isHeld(entry users.UserState) bool {
+	return sm.holdUnpaid && sm.price > 0 && entry.ChatID != 0 && entry.Payment != users.PaymentPaid
+}
+
+// GetHeld returns the entries waiting in line that are held until their payment is confirmed
+func (sm *StateManager) GetHeld() []users.UserState {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	var held []users.UserState
+	for _, state := range sm.inLine() {
+		if sm.isHeld(state) {
+			held = append(held, state)
+		}
+	}
+	sort.Sort(ByOrder(held))
+	return held
+}
+
+// SetPayment sets the payment status of the entries and returns them updated, entries that are gone
+// from the list are skipped. A confirmed payment is never taken back: entries already paid are left
+// as they are and returned separately.
+func (sm *StateManager) SetPayment(ctx context.Context, stateIDs []int, status string) (updated, alreadyPaid []users.UserState, err error) {
+	updated, alreadyPaid, err = sm.setPayment(ctx, stateIDs, status)
+	if err == nil && len(updated) > 0 {
+		sm.emit(ctx, Event{Type: EventQueueChanged})
+	}
+	return updated, alreadyPaid, err
+}
+
+func (sm *StateManager) setPayment(ctx context.Context, stateIDs []int, status string) (updated, alreadyPaid []users.UserState, err error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ids := make(map[int]bool, len(stateIDs))
+	for _, id := range stateIDs {
+		ids[id] = true
+	}
+
+	for i, state := range sm.list {
+		if !ids[state.ID] {
+			continue
+		}
+		if state.Payment == users.PaymentPaid && status != users.PaymentPaid {
+			alreadyPaid = append(alreadyPaid, state)
+			continue
+		}
+		sm.list[i].Payment = status
+		if status == users.PaymentPending {
+			sm.list[i].PaymentSentAt = time.Now()
+		}
+		updated = append(updated, sm.list[i])
+	}
+
+	if err := sm.store.SaveEntries(ctx, updated...); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored list\nError: %v", err))
+		return updated, alreadyPaid, err
+	}
+	return updated, alreadyPaid, nil
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sukalov/karaokebot/internal/logger"
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// GetSession returns the karaoke night in progress. When the line was filled before
+// sessions existed, a session starting with the earliest signup is made up for it.
+func (sm *StateManager) GetSession() (users.Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.currentSession()
+}
+
+// currentSession must be called with the lock held
+func (sm *StateManager) currentSession() (users.Session, bool) {
+	if sm.session != nil {
+		return *sm.session, true
+	}
+	if len(sm.list) == 0 {
+		return users.Session{}, false
+	}
+
+	openedAt := time.Now()
+	for _, state := range sm.list {
+		if !state.TimeAdded.IsZero() && state.TimeAdded.Before(openedAt) {
+			openedAt = state.TimeAdded
+		}
+	}
+	return users.Session{ID: openedAt.Unix(), OpenedAt: openedAt}, true
+}
+
+// ArchiveFunc saves a finished night with its price and every entry of the line
+type ArchiveFunc func(session users.Session, price int, entries []users.UserState) error
+
+// EndSession archives the night, closes the signup and starts over with an empty line.
+// Archiving and clearing happen under one lock, so signups coming in meanwhile wait and land
+// in the next night instead of being lost. When archive fails the line is left as it was.
+func (sm *StateManager) EndSession(ctx context.Context, archive ArchiveFunc) error {
+	sm.mu.Lock()
+	if session, ok := sm.currentSession(); ok {
+		entries := make([]users.UserState, len(sm.list))
+		copy(entries, sm.list)
+		if err := archive(session, sm.price, entries); err != nil {
+			sm.mu.Unlock()
+			return fmt.Errorf("failed to archive session %d: %w", session.ID, err)
+		}
+	}
+
+	sm.list = []users.UserState{}
+	sm.open = false
+	sm.session = nil
+
+	err := sm.store.Reset(ctx, map[string]interface{}{
+		keyOpen:    false,
+		keySession: nil,
+	})
+	if err != nil {
+		logger.Error(false, fmt.Sprintf(" Error ending session in store\nError: %v", err))
+	}
+	sm.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	sm.emit(ctx, Event{Type: EventQueueChanged})
+	return nil
+}
@@ -2,34 +2,75 @@ package state
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/sukalov/karaokebot/internal/logger"
-	"github.com/sukalov/karaokebot/internal/redis"
 	"github.com/sukalov/karaokebot/internal/users"
 )
 
 type StateManager struct {
-	mu    sync.RWMutex
-	list  []users.UserState
-	open  bool
-	limit int
-	price int
+	mu             sync.RWMutex
+	list           []users.UserState
+	open           bool
+	limit          int
+	price          int
+	waitingLimit   int
+	songDuration   int
+	ordering       string
+	session        *users.Session
+	holdUnpaid     bool
+	paymentMethods []PaymentMethod
+	listeners      []Listener
+	store          Store
 }
 
+const (
+	// EventQueueAdvanced fires when somebody leaves the stage or is called to it
+	EventQueueAdvanced = "queue_advanced"
+	// EventQueueChanged fires when waiting entries are reordered or removed
+	EventQueueChanged = "queue_changed"
+)
+
+// Event describes a queue change that listeners may react to
+type Event struct {
+	Type  string
+	Entry users.UserState
+}
+
+// Listener is called after a queue change has been applied and persisted
+type Listener func(ctx context.Context, event Event)
+
 type ByTimeAdded []users.UserState
 
 func (a ByTimeAdded) Len() int           { return len(a) }
 func (a ByTimeAdded) Less(i, j int) bool { return a[i].TimeAdded.Before(a[j].TimeAdded) }
 func (a ByTimeAdded) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
-func NewStateManager() *StateManager {
+// ByOrder sorts entries by their explicit place in line, entries without one keep the signup order
+type ByOrder []users.UserState
+
+func (a ByOrder) Len() int { return len(a) }
+func (a ByOrder) Less(i, j int) bool {
+	if a[i].Order != a[j].Order {
+		return a[i].Order < a[j].Order
+	}
+	return a[i].TimeAdded.Before(a[j].TimeAdded)
+}
+func (a ByOrder) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+func NewStateManager(store Store) *StateManager {
 	return &StateManager{
-		list:  []users.UserState{},
-		open:  false,
-		limit: 3,
-		price: 0,
+		store:        store,
+		list:         []users.UserState{},
+		open:         false,
+		limit:        3,
+		price:        0,
+		songDuration: defaultSongMinutes,
+		ordering:     OrderingFIFO,
 	}
 }
 
@@ -37,53 +78,159 @@ func (sm *StateManager) Init() error {
 	ctx := context.Background()
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	// Retrieve the list from Redis
-	list, err := redis.GetList(ctx)
-	open, err2 := redis.GetOpen(ctx)
-	limit, err3 := redis.GetLimit(ctx)
-	price, err4 := redis.GetPrice(ctx)
+	list, err := sm.store.LoadEntries(ctx)
 	if err != nil {
 		return err
 	}
-	if err2 != nil {
-		return err2
-	}
-	if err3 != nil {
-		return err3
+
+	var (
+		open           bool
+		limit          = sm.limit
+		waitingLimit   int
+		price          int
+		songDuration   int
+		ordering       string
+		session        *users.Session
+		holdUnpaid     bool
+		paymentMethods []PaymentMethod
+	)
+	settings := map[string]interface{}{
+		keyOpen:           &open,
+		keyLimit:          &limit,
+		keyWaitingLimit:   &waitingLimit,
+		keyPrice:          &price,
+		keySongDuration:   &songDuration,
+		keyOrdering:       &ordering,
+		keySession:        &session,
+		keyHoldUnpaid:     &holdUnpaid,
+		keyPaymentMethods: &paymentMethods,
 	}
-	if err4 != nil {
-		return err4
+	for key, value := range settings {
+		if err := sm.store.Load(ctx, key, value); err != nil {
+			return fmt.Errorf("failed to load %s: %w", key, err)
+		}
 	}
+
 	sm.list = list
 	sm.open = open
 	sm.limit = limit
+	if limit >= legacyNoLimit {
+		sm.limit = NoLimit
+	}
+	sm.waitingLimit = waitingLimit
 	sm.price = price
+	if songDuration > 0 {
+		sm.songDuration = songDuration
+	}
+	if ordering != "" {
+		sm.ordering = ordering
+	}
+	sm.session = session
+	sm.holdUnpaid = holdUnpaid
+	sm.paymentMethods = paymentMethods
+
+	maxID := 0
+	for _, state := range list {
+		if state.ID > maxID {
+			maxID = state.ID
+		}
+	}
+	if err := sm.store.RaiseEntryID(ctx, maxID); err != nil {
+		return err
+	}
 	return nil
 }
 
+// Subscribe registers a listener for queue events
+func (sm *StateManager) Subscribe(listener Listener) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.listeners = append(sm.listeners, listener)
+}
+
+// emit must be called without the lock held, listeners are free to read the state
+func (sm *StateManager) emit(ctx context.Context, event Event) {
+	sm.mu.RLock()
+	listeners := append([]Listener(nil), sm.listeners...)
+	sm.mu.RUnlock()
+	for _, listener := range listeners {
+		listener(ctx, event)
+	}
+}
+
 func (sm *StateManager) IsOpen() bool {
 	return sm.open
 }
 
+// NextID allocates an entry ID that stays unique for the whole life of the line,
+// even after entries are removed
+func (sm *StateManager) NextID(ctx context.Context) (int, error) {
+	id, err := sm.store.NextEntryID(ctx)
+	if err != nil {
+		logger.Error(false, fmt.Sprintf(" Error allocating entry ID in store\nError: %v", err))
+		return 0, err
+	}
+	return id, nil
+}
+
 func (sm *StateManager) AddUser(ctx context.Context, state users.UserState) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	return sm.addUser(ctx, state)
+}
+
+// addUser must be called with the lock held
+func (sm *StateManager) addUser(ctx context.Context, state users.UserState) error {
+	if state.Stage == users.StageInLine && state.Order == 0 {
+		state.Order = sm.nextOrder()
+	}
 	sm.list = append(sm.list, state)
-	if err := redis.SetList(ctx, sm.list); err != nil {
-		logger.Error(false, fmt.Sprintf(" Error adding to redis list\nError: %v", err))
+	if err := sm.store.SaveEntries(ctx, state); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error adding to stored list\nError: %v", err))
 		return err
 	}
 	return nil
 }
 
+// AddWalkIn puts a singer without a Telegram account straight to the end of the line
+func (sm *StateManager) AddWalkIn(ctx context.Context, state users.UserState) (users.UserState, error) {
+	id, err := sm.NextID(ctx)
+	if err != nil {
+		return state, err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	state.ID = id
+	state.ChatID = 0
+	state.Stage = users.StageInLine
+	state.TimeAdded = time.Now()
+	state.Order = sm.nextOrder()
+	sm.list = append(sm.list, state)
+	if err := sm.store.SaveEntries(ctx, state); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error adding to stored list\nError: %v", err))
+		return state, err
+	}
+	return state, nil
+}
+
+// OpenList opens the signup, starting a new karaoke night if none is in progress
 func (sm *StateManager) OpenList(ctx context.Context) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.open = true
-	if err := redis.SetOpen(ctx, true); err != nil {
-		logger.Error(false, fmt.Sprintf(" Error saving list state to redis\nError: %v", err))
+	if err := sm.store.Save(ctx, keyOpen, true); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error saving list state to store\nError: %v", err))
 		return err
 	}
+	if sm.session == nil {
+		now := time.Now()
+		sm.session = &users.Session{ID: now.Unix(), OpenedAt: now}
+		if err := sm.store.Save(ctx, keySession, sm.session); err != nil {
+			logger.Error(false, fmt.Sprintf(" Error saving session to store\nError: %v", err))
+			return err
+		}
+	}
 	return nil
 }
 
@@ -91,8 +238,8 @@ func (sm *StateManager) CloseList(ctx context.Context) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.open = false
-	if err := redis.SetOpen(ctx, false); err != nil {
-		logger.Error(false, fmt.Sprintf(" Error saving list state to redis\nError: %v", err))
+	if err := sm.store.Save(ctx, keyOpen, false); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error saving list state to store\nError: %v", err))
 		return err
 	}
 	return nil
@@ -104,12 +251,25 @@ func (sm *StateManager) GetAll() []users.UserState {
 	return sm.list
 }
 
+// Get returns the entry with the given ID
+func (sm *StateManager) Get(stateID int) (users.UserState, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	for _, state := range sm.list {
+		if state.ID == stateID {
+			return state, true
+		}
+	}
+	return users.UserState{}, false
+}
+
+// GetAllThisUser returns the entries the chat signed up for or joined as a co-singer
 func (sm *StateManager) GetAllThisUser(chatID int64) []users.UserState {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 	var thisUserStates []users.UserState
 	for _, state := range sm.list {
-		if state.ChatID == chatID {
+		if state.HasSinger(chatID) {
 			thisUserStates = append(thisUserStates, state)
 		}
 	}
@@ -119,6 +279,114 @@ func (sm *StateManager) GetAllThisUser(chatID int64) []users.UserState {
 func (sm *StateManager) GetAllInLine() []users.UserState {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
+	return sm.inLine()
+}
+
+// GetQueue returns the entries still waiting in line, in the order they will be called
+func (sm *StateManager) GetQueue() []users.UserState {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.queue()
+}
+
+// GetCurrent returns the entry that is on stage right now
+func (sm *StateManager) GetCurrent() (users.UserState, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	for _, state := range sm.list {
+		if state.Stage == users.StagePerforming {
+			return state, true
+		}
+	}
+	return users.UserState{}, false
+}
+
+// CallNext marks the current singer as performed and puts the first waiting entry on stage.
+// The returned flag is false when nobody is left in line.
+func (sm *StateManager) CallNext(ctx context.Context) (users.UserState, bool, error) {
+	next, found, err := sm.callNext(ctx)
+	if err == nil {
+		sm.emit(ctx, Event{Type: EventQueueAdvanced, Entry: next})
+	}
+	return next, found, err
+}
+
+func (sm *StateManager) callNext(ctx context.Context) (users.UserState, bool, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var changed []users.UserState
+	if finished, ok := sm.finishCurrent(users.StagePerformed); ok {
+		changed = append(changed, finished)
+	}
+
+	queue := sm.queue()
+	if len(queue) == 0 {
+		if err := sm.store.SaveEntries(ctx, changed...); err != nil {
+			logger.Error(false, fmt.Sprintf(" Error updating stored list\nError: %v", err))
+			return users.UserState{}, false, err
+		}
+		return users.UserState{}, false, nil
+	}
+
+	var next users.UserState
+	for i, state := range sm.list {
+		if state.ID == queue[0].ID {
+			sm.list[i].Stage = users.StagePerforming
+			sm.list[i].TimeCalled = time.Now()
+			next = sm.list[i]
+			break
+		}
+	}
+	changed = append(changed, next)
+
+	if err := sm.store.SaveEntries(ctx, changed...); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored list\nError: %v", err))
+		return next, true, err
+	}
+	return next, true, nil
+}
+
+// FinishCurrent takes the current singer off stage with one of the final stages
+// (performed, skipped or no-show). The returned flag is false when nobody was on stage.
+func (sm *StateManager) FinishCurrent(ctx context.Context, stage string) (users.UserState, bool, error) {
+	finished, found, err := sm.finishCurrentAndSave(ctx, stage)
+	if found && err == nil {
+		sm.emit(ctx, Event{Type: EventQueueAdvanced, Entry: finished})
+	}
+	return finished, found, err
+}
+
+func (sm *StateManager) finishCurrentAndSave(ctx context.Context, stage string) (users.UserState, bool, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	finished, ok := sm.finishCurrent(stage)
+	if !ok {
+		return users.UserState{}, false, nil
+	}
+
+	if err := sm.store.SaveEntries(ctx, finished); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored list\nError: %v", err))
+		return finished, true, err
+	}
+	return finished, true, nil
+}
+
+// finishCurrent must be called with the write lock held
+func (sm *StateManager) finishCurrent(stage string) (users.UserState, bool) {
+	for i, state := range sm.list {
+		if state.Stage == users.StagePerforming {
+			sm.list[i].Stage = stage
+			sm.list[i].TimeFinished = time.Now()
+			return sm.list[i], true
+		}
+	}
+	return users.UserState{}, false
+}
+
+// inLine must be called with the lock held
+func (sm *StateManager) inLine() []users.UserState {
 	var inLineUsers []users.UserState
 	for _, state := range sm.list {
 		if state.Stage == users.StageInLine {
@@ -128,45 +396,93 @@ func (sm *StateManager) GetAllInLine() []users.UserState {
 	return inLineUsers
 }
 
+// queue must be called with the lock held, entries held until payment are left out
+func (sm *StateManager) queue() []users.UserState {
+	var queue []users.UserState
+	for _, state := range sm.inLine() {
+		if !sm.isHeld(state) {
+			queue = append(queue, state)
+		}
+	}
+	sort.Sort(ByOrder(queue))
+	if sm.ordering == OrderingRoundRobin {
+		sm.interleave(queue)
+	}
+	// entries an admin moved to the top go first whatever the strategy
+	sort.SliceStable(queue, func(i, j int) bool { return queue[i].Pinned && !queue[j].Pinned })
+	return queue
+}
+
+// nextOrder must be called with the lock held
+func (sm *StateManager) nextOrder() int {
+	maxOrder := 0
+	for _, state := range sm.list {
+		if state.Order > maxOrder {
+			maxOrder = state.Order
+		}
+	}
+	return maxOrder + 1
+}
+
 func (sm *StateManager) Clear(ctx context.Context) error {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	sm.list = []users.UserState{}
-	if err := redis.SetList(ctx, sm.list); err != nil {
-		logger.Error(false, fmt.Sprintf(" Error clearing redis list\nError: %v", err))
+	if err := sm.store.Reset(ctx, nil); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error clearing stored list\nError: %v", err))
+		return err
 	}
 	return nil
 }
 
-func (sm *StateManager) EditState(ctx context.Context, stateID int, newState users.UserState) error {
+// ErrStageChanged means the entry moved on, e.g. the host called it, while the user was editing it
+var ErrStageChanged = errors.New("entry is no longer at the expected stage")
+
+// UpdateEntry changes an entry in place under the lock, so edits made by others in the meantime are kept.
+// The entry must still be at stage, otherwise ErrStageChanged is returned and nothing is written;
+// edit may change the entry or return an error to leave it as is. Entries moving into the line get
+// the next order. The updated entry is returned.
+func (sm *StateManager) UpdateEntry(ctx context.Context, stateID int, stage string, edit func(entry *users.UserState) error) (users.UserState, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	for i, state := range sm.list {
-		if state.ID == stateID {
-			sm.list[i] = newState
-			if err := redis.SetList(ctx, sm.list); err != nil {
-				logger.Error(false, fmt.Sprintf(" Error updating redis list\nError: %v", err))
-				return err
-			}
-			return nil
+		if state.ID != stateID {
+			continue
+		}
+		if state.Stage != stage {
+			return state, ErrStageChanged
+		}
+
+		updated := state
+		updated.Participants = append([]users.Participant(nil), state.Participants...)
+		if err := edit(&updated); err != nil {
+			return state, err
 		}
+		updated.ID = state.ID
+		if updated.Stage == users.StageInLine && state.Stage != users.StageInLine {
+			updated.Order = sm.nextOrder()
+		}
+		if err := sm.store.SaveEntries(ctx, updated); err != nil {
+			logger.Error(false, fmt.Sprintf(" Error updating stored list\nError: %v", err))
+			return state, err
+		}
+		sm.list[i] = updated
+		return updated, nil
 	}
 
-	return fmt.Errorf("state with ID %d not found", stateID)
+	return users.UserState{}, fmt.Errorf("state with ID %d not found", stateID)
 }
 
-func (sm *StateManager) Sync(ctx context.Context) error {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	if err := redis.SetList(ctx, sm.list); err != nil {
-		logger.Error(false, fmt.Sprintf(" Error updating redis list\nError: %v", err))
+func (sm *StateManager) RemoveState(ctx context.Context, stateID int) error {
+	if err := sm.removeState(ctx, stateID); err != nil {
 		return err
 	}
+	sm.emit(ctx, Event{Type: EventQueueChanged})
 	return nil
 }
 
-func (sm *StateManager) RemoveState(ctx context.Context, stateID int) error {
+func (sm *StateManager) removeState(ctx context.Context, stateID int) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	result := []users.UserState{}
@@ -176,14 +492,17 @@ func (sm *StateManager) RemoveState(ctx context.Context, stateID int) error {
 		}
 	}
 	sm.list = result
-	if err := redis.SetList(ctx, result); err != nil {
-		logger.Error(false, fmt.Sprintf(" Error updating redis list\nError: %v", err))
+	if err := sm.store.DeleteEntry(ctx, stateID); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored list\nError: %v", err))
 		return err
 	}
 	return nil
 }
 
+// GetLimit is how many songs a singer may sing per night, NoLimit when anyone sings as much as they like
 func (sm *StateManager) GetLimit() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 	return sm.limit
 }
 
@@ -191,8 +510,8 @@ func (sm *StateManager) SetLimit(ctx context.Context, limit int) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.limit = limit
-	if err := redis.SetLimit(ctx, limit); err != nil {
-		logger.Error(false, fmt.Sprintf(" Error updating redis limit\nError: %v", err))
+	if err := sm.store.Save(ctx, keyLimit, limit); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored limit\nError: %v", err))
 		return err
 	}
 	return nil
@@ -208,8 +527,8 @@ func (sm *StateManager) SetPrice(ctx context.Context, price int) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.price = price
-	if err := redis.SetPrice(ctx, price); err != nil {
-		logger.Error(false, fmt.Sprintf(" Error updating redis price\nError: %v", err))
+	if err := sm.store.Save(ctx, keyPrice, price); err != nil {
+		logger.Error(false, fmt.Sprintf(" Error updating stored price\nError: %v", err))
 		return err
 	}
 	return nil
@@ -0,0 +1,39 @@
+package state
+
+import (
+	"context"
+
+	"github.com/sukalov/karaokebot/internal/users"
+)
+
+// Settings the state manager keeps next to the entries
+const (
+	keyOpen           = "open"
+	keyLimit          = "limit"
+	keyWaitingLimit   = "waiting_limit"
+	keyPrice          = "price"
+	keySongDuration   = "song_duration"
+	keyOrdering       = "ordering"
+	keySession        = "session"
+	keyHoldUnpaid     = "hold_unpaid"
+	keyPaymentMethods = "payment_methods"
+)
+
+// Store persists the line and its settings. Every change is written as it happens,
+// so the state manager can be restored with Init after a restart.
+type Store interface {
+	// LoadEntries returns all entries sorted by ID
+	LoadEntries(ctx context.Context) ([]users.UserState, error)
+	// SaveEntries writes the given entries at once, other entries are left untouched
+	SaveEntries(ctx context.Context, entries ...users.UserState) error
+	DeleteEntry(ctx context.Context, id int) error
+	// Reset removes every entry and applies the settings at once, a nil setting is deleted
+	Reset(ctx context.Context, settings map[string]interface{}) error
+	// NextEntryID allocates an entry ID that has never been used before
+	NextEntryID(ctx context.Context) (int, error)
+	// RaiseEntryID makes sure IDs up to minID are never allocated again
+	RaiseEntryID(ctx context.Context, minID int) error
+	// Load decodes a setting into v, v is left untouched when the setting was never saved
+	Load(ctx context.Context, key string, v interface{}) error
+	Save(ctx context.Context, key string, v interface{}) error
+}
@@ -0,0 +1,11 @@
+package users
+
+import (
+	"time"
+)
+
+// Session is one karaoke night, from opening the signup until the line is archived
+type Session struct {
+	ID       int64     `json:"id"`
+	OpenedAt time.Time `json:"opened_at"`
+}
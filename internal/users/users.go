@@ -5,22 +5,84 @@ import (
 )
 
 type UserState struct {
-	ID         int       `json:"id"`
-	ChatID     int64     `json:"chat_id"`
-	Username   string    `json:"username"`
-	TgName     string    `json:"tg_name"`
-	SongID     string    `json:"song_id"`
-	SongName   string    `json:"song_name"`
-	SongLink   string    `json:"song_link"`
-	SongNote   string    `json:"additional_chords"`
-	Stage      string    `json:"stage"`
-	TimeAdded  time.Time `json:"time_added"`
-	TypedName  string    `json:"typed_name"`
-	LyricsURL  string    `json:"lyrics_url"`
-	LyricsText string    `json:"lyrics_text"`
+	ID           int       `json:"id"`
+	ChatID       int64     `json:"chat_id"`
+	Username     string    `json:"username"`
+	TgName       string    `json:"tg_name"`
+	SongID       string    `json:"song_id"`
+	SongName     string    `json:"song_name"`
+	SongLink     string    `json:"song_link"`
+	SongNote     string    `json:"additional_chords"`
+	Stage        string    `json:"stage"`
+	Order        int       `json:"order"`
+	Pinned       bool      `json:"pinned"`
+	TimeAdded    time.Time `json:"time_added"`
+	TimeCalled   time.Time `json:"time_called"`
+	TimeFinished time.Time `json:"time_finished"`
+	TypedName    string    `json:"typed_name"`
+	LyricsURL    string    `json:"lyrics_url"`
+	LyricsText   string    `json:"lyrics_text"`
+	// Participants are the co-singers who joined the entry from their own chats
+	Participants []Participant `json:"participants,omitempty"`
+	// InviteCode lets others join the entry through a link, empty until someone is invited
+	InviteCode string `json:"invite_code,omitempty"`
+	// Payment is the payment status on paid nights, see the Payment constants
+	Payment string `json:"payment,omitempty"`
+	// PaymentSentAt is when the singer last sent a payment screenshot for the entry
+	PaymentSentAt time.Time `json:"payment_sent_at"`
+}
+
+// Participant is someone singing together with the person who signed up
+type Participant struct {
+	ChatID   int64  `json:"chat_id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
 }
 
 const (
 	StageAskingName = "asking_name"
 	StageInLine     = "in_line"
+	StagePerforming = "performing"
+	StagePerformed  = "performed"
+	StageSkipped    = "skipped"
+	StageNoShow     = "no_show"
+)
+
+// Payment statuses of an entry, the singer sends a screenshot and an admin checks it
+const (
+	PaymentUnpaid   = ""
+	PaymentPending  = "pending"
+	PaymentPaid     = "paid"
+	PaymentRejected = "rejected"
 )
+
+// IsFinished reports whether the entry has left the line for good
+func (u UserState) IsFinished() bool {
+	switch u.Stage {
+	case StagePerformed, StageSkipped, StageNoShow:
+		return true
+	}
+	return false
+}
+
+// ChatIDs returns the chats of everyone singing the entry, the one who signed up goes first
+func (u UserState) ChatIDs() []int64 {
+	var chatIDs []int64
+	if u.ChatID != 0 {
+		chatIDs = append(chatIDs, u.ChatID)
+	}
+	for _, participant := range u.Participants {
+		chatIDs = append(chatIDs, participant.ChatID)
+	}
+	return chatIDs
+}
+
+// HasSinger reports whether the chat signed up for the entry or joined it
+func (u UserState) HasSinger(chatID int64) bool {
+	for _, id := range u.ChatIDs() {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
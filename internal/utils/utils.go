@@ -28,3 +28,30 @@ func ConvertToMoscowTime(t time.Time) string {
 	moscowLocation := time.FixedZone("Moscow Time", 3*60*60)
 	return t.In(moscowLocation).Format("15:04:05")
 }
+
+// GetEnv returns an optional environment variable, or fallback when it is not set
+func GetEnv(key, fallback string) string {
+	_ = godotenv.Load()
+
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Plural picks the russian word form for n: one for 1 and 21, few for 2-4 and 22-24, many for the rest
+func Plural(n int, one, few, many string) string {
+	n %= 100
+	if n < 0 {
+		n = -n
+	}
+	switch {
+	case n >= 11 && n <= 14:
+		return many
+	case n%10 == 1:
+		return one
+	case n%10 >= 2 && n%10 <= 4:
+		return few
+	}
+	return many
+}